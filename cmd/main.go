@@ -2,12 +2,15 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"net"
 	"os"
+	"strings"
+	"time"
 
 	"cloud.google.com/go/firestore"
 	firebase "firebase.google.com/go"
@@ -17,14 +20,28 @@ import (
 	echomiddleware "github.com/labstack/echo/v4/middleware"
 	middleware "github.com/oapi-codegen/echo-middleware"
 	"github.com/shotokan/firebase-training/internal/common"
+	"github.com/shotokan/firebase-training/internal/common/idempotency"
 	"github.com/shotokan/firebase-training/internal/users/adapters"
+	"github.com/shotokan/firebase-training/internal/users/models"
 	"github.com/shotokan/firebase-training/internal/users/ports"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/api/option"
 )
 
 func main() {
 	port := flag.String("port", "8080", "Port for test HTTP server")
+	repository := flag.String("repository", "firestore", "User repository backend: firestore or memory")
+	bcryptCost := flag.Int("bcrypt-cost", bcrypt.DefaultCost, "Cost of the bcrypt password hashes")
+	deletedUserRetention := flag.Duration("deleted-user-retention", 30*24*time.Hour, "How long soft-deleted users can be restored before they are purged")
+	purgeInterval := flag.Duration("purge-interval", time.Hour, "How often soft-deleted users are purged, 0 disables purging")
+	authModes := flag.String("auth", common.AuthModeFirebase, "Comma-separated auth modes tried in order: firebase, jws or both, like jws,firebase")
+	emailClaim := flag.String("email-claim", "email", "Token claim holding the email of the user")
+	roleClaim := flag.String("role-claim", "role", "Token claim holding the role of the user, users without it get the user role")
+	nameClaim := flag.String("name-claim", "name", "Token claim holding the display name of the user")
+	permissionsClaim := flag.String("permissions-claim", common.PermissionsClaim, "Token claim holding the permissions of the user")
+	requiredClaims := flag.String("required-claims", "", "Comma-separated claims every token must have, like email,role")
+	idempotencyTTL := flag.Duration("idempotency-ttl", idempotency.DefaultTTL, "How long idempotency keys are kept")
 	flag.Parse()
 
 	// Create a fake authenticator. This allows us to issue tokens, and also
@@ -39,30 +56,24 @@ func main() {
 	// Log all requests
 	e.Use(echomiddleware.Logger())
 
-	// path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
-	client, err := firestore.NewClient(context.Background(), os.Getenv("GCP_PROJECT"))
-	if err != nil {
-		e.Logger.Fatal(err)
-	}
-
-	var opts []option.ClientOption
-	if file := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); file != "" {
-		opts = append(opts, option.WithCredentialsFile(file))
+	claims := common.NewClaimsDecoder(models.RoleUser)
+	claims.Email.Name = *emailClaim
+	claims.Role.Name = *roleClaim
+	claims.DisplayName.Name = *nameClaim
+	claims.Permissions.Name = *permissionsClaim
+	if *requiredClaims != "" {
+		if err := claims.Require(strings.Split(*requiredClaims, ",")...); err != nil {
+			log.Fatalln("error requiring claims:", err)
+		}
 	}
 
-	config := &firebase.Config{ProjectID: os.Getenv("GCP_PROJECT")}
-	firebaseApp, err := firebase.NewApp(context.Background(), config, opts...)
-	if err != nil {
-		logrus.Fatalf("error initializing app: %v\n", err)
-	}
-
-	authClient, err := firebaseApp.Auth(context.Background())
+	verifier, err := CreateTokenVerifier(*authModes, fa, claims)
 	if err != nil {
-		logrus.WithError(err).Fatal("Unable to create firebase Auth client")
+		log.Fatalln("error creating token verifier:", err)
 	}
 
 	// Create middleware for validating tokens.
-	mw, err := CreateMiddleware(fa, authClient)
+	mw, err := CreateMiddleware(verifier)
 	if err != nil {
 		log.Fatalln("error creating middleware:", err)
 	}
@@ -71,19 +82,51 @@ func main() {
 	// OpenAPI schema.
 	e.Use(mw...)
 
-	userRepo := adapters.NewUserFirestoreRepository(client)
-	users := ports.NewHttpServer(userRepo)
-	ports.RegisterHandlers(e, users)
-	// We're going to print some useful things for interacting with this server.
-	// This token allows access to any API's with no specific claims.
-	readerJWS, err := fa.CreateJWSWithClaims([]string{})
+	passwordHasher, err := adapters.NewBcryptPasswordHasher(*bcryptCost)
+	if err != nil {
+		log.Fatalln("error creating password hasher:", err)
+	}
+	// The user repository and the idempotency store share one client.
+	var firestoreClient *firestore.Client
+	if *repository == "firestore" {
+		firestoreClient, err = FirestoreClient()
+		if err != nil {
+			log.Fatalln("error creating firestore client:", err)
+		}
+		defer firestoreClient.Close()
+	}
+	userRepo, err := CreateUserRepository(*repository, firestoreClient, passwordHasher)
 	if err != nil {
-		log.Fatalln("error creating reader JWS:", err)
+		log.Fatalln("error creating user repository:", err)
 	}
-	// This token allows access to API's with no scopes, and with the "things:w" claim.
-	writerJWS, err := fa.CreateJWSWithClaims([]string{"things:w"})
+	idempotencyStore, err := CreateIdempotencyStore(*repository, firestoreClient)
 	if err != nil {
-		log.Fatalln("error creating writer JWS:", err)
+		log.Fatalln("error creating idempotency store:", err)
+	}
+	// Mutation endpoints opt in to Idempotency-Key here.
+	e.Use(idempotency.Middleware(idempotency.Config{
+		Skipper: idempotency.OnlyRoutes("POST /users"),
+		Store:   idempotencyStore,
+		TTL:     *idempotencyTTL,
+	}))
+	pageTokenSecret, err := PageTokenSecret()
+	if err != nil {
+		log.Fatalln("error loading page token secret:", err)
+	}
+	users := ports.NewHttpServer(userRepo, passwordHasher, ports.NewPageTokenCodec(pageTokenSecret), ports.DefaultUserPolicies)
+	ports.RegisterHandlers(ports.NewCustomMethodRouter(e), users)
+
+	if *purgeInterval < 0 {
+		log.Fatalln("-purge-interval can't be negative:", *purgeInterval)
+	}
+	purger := ports.NewDeletedUsersPurger(userRepo, *deletedUserRetention, *purgeInterval)
+	go purger.Run(context.Background())
+
+	// We're going to print some useful things for interacting with this server.
+	// The tokens are accepted by the jws auth mode.
+	readerJWS, writerJWS, err := CreateFakeTokens(fa)
+	if err != nil {
+		log.Fatalln("error creating fake tokens:", err)
 	}
 
 	log.Println("Reader token", string(readerJWS))
@@ -99,7 +142,118 @@ func main() {
 	e.Logger.Fatal(e.Start(net.JoinHostPort("0.0.0.0", *port)))
 }
 
-func CreateMiddleware(v common.JWSValidator, authClient *auth.Client) ([]echo.MiddlewareFunc, error) {
+// CreateUserRepository builds the user repository selected at startup. The
+// memory backend needs no GCP project, which makes it handy for tests and
+// offline development. Firestore hashes the plaintext passwords of the first
+// users with passwordHasher as they are upgraded.
+func CreateUserRepository(backend string, client *firestore.Client, passwordHasher adapters.PasswordHasher) (ports.UserRepository, error) {
+	switch backend {
+	case "firestore":
+		return adapters.NewUserFirestoreRepository(client, passwordHasher), nil
+	case "memory":
+		return adapters.NewUserMemoryRepository(), nil
+	default:
+		return nil, fmt.Errorf("unknown repository backend %q", backend)
+	}
+}
+
+// CreateIdempotencyStore keeps idempotency keys next to the users, so keys
+// are shared by all instances using Firestore.
+func CreateIdempotencyStore(backend string, client *firestore.Client) (idempotency.Store, error) {
+	switch backend {
+	case "firestore":
+		return idempotency.NewFirestoreStore(client, "idempotencyKeys"), nil
+	case "memory":
+		return idempotency.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown repository backend %q", backend)
+	}
+}
+
+// PageTokenSecret returns the key signing page tokens. Without PAGE_TOKEN_SECRET
+// a random key is used, so tokens don't survive restarts and can't be shared
+// between instances.
+func PageTokenSecret() ([]byte, error) {
+	if secret := os.Getenv("PAGE_TOKEN_SECRET"); secret != "" {
+		return []byte(secret), nil
+	}
+
+	logrus.Warn("PAGE_TOKEN_SECRET is not set, using a random page token secret")
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("generating page token secret: %w", err)
+	}
+
+	return secret, nil
+}
+
+// CreateTokenVerifier builds the verifier of the auth modes. The jws mode
+// accepts the tokens of the fake authenticator, like the ones printed at
+// startup.
+func CreateTokenVerifier(modes string, fa *common.FakeAuthenticator, claims common.ClaimsDecoder) (common.TokenVerifier, error) {
+	return common.NewTokenVerifier(modes, func(mode string) (common.TokenVerifier, error) {
+		if mode == common.AuthModeJWS {
+			return common.NewJWSVerifier(fa, claims), nil
+		}
+
+		authClient, err := FirebaseAuthClient()
+		if err != nil {
+			return nil, err
+		}
+		return common.NewFirebaseVerifier(authClient, claims), nil
+	})
+}
+
+// FirestoreClient connects to the Firestore database of GCP_PROJECT.
+func FirestoreClient() (*firestore.Client, error) {
+	// path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	client, err := firestore.NewClient(context.Background(), os.Getenv("GCP_PROJECT"))
+	if err != nil {
+		return nil, fmt.Errorf("creating firestore client: %w", err)
+	}
+
+	return client, nil
+}
+
+// CreateFakeTokens issues the tokens printed at startup. The reader is a
+// trainer with the "users:read" scope, so it may list and read users. The
+// writer is an admin which also has the "users:write" scope. Both use the
+// default claim names, they don't follow -role-claim or -permissions-claim.
+func CreateFakeTokens(fa *common.FakeAuthenticator) (reader []byte, writer []byte, err error) {
+	reader, err = fa.CreateJWSWithClaims(models.RoleTrainer, []string{"users:read"})
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating reader JWS: %w", err)
+	}
+	writer, err = fa.CreateJWSWithClaims(models.RoleAdmin, []string{"users:read", "users:write"})
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating writer JWS: %w", err)
+	}
+
+	return reader, writer, nil
+}
+
+func FirebaseAuthClient() (*auth.Client, error) {
+	var opts []option.ClientOption
+	if file := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); file != "" {
+		opts = append(opts, option.WithCredentialsFile(file))
+	}
+
+	config := &firebase.Config{ProjectID: os.Getenv("GCP_PROJECT")}
+	firebaseApp, err := firebase.NewApp(context.Background(), config, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("initializing app: %w", err)
+	}
+
+	authClient, err := firebaseApp.Auth(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("creating firebase Auth client: %w", err)
+	}
+
+	return authClient, nil
+}
+
+func CreateMiddleware(verifier common.TokenVerifier) ([]echo.MiddlewareFunc, error) {
 	spec, err := ports.GetSwagger()
 	if err != nil {
 		return nil, fmt.Errorf("loading spec: %w", err)
@@ -107,12 +261,13 @@ func CreateMiddleware(v common.JWSValidator, authClient *auth.Client) ([]echo.Mi
 	// Clear out the servers array in the swagger spec, that skips validating
 	// that server names match. We don't know how this thing will be run.
 	spec.Servers = nil
+
 	validator := middleware.OapiRequestValidatorWithOptions(spec,
 		&middleware.Options{
 			Options: openapi3filter.Options{
-				AuthenticationFunc: common.NewAuthenticator(v, authClient),
+				AuthenticationFunc: common.NewAuthenticator(verifier),
 			},
 		})
 
-	return []echo.MiddlewareFunc{validator}, nil
+	return []echo.MiddlewareFunc{validator, common.UserContextMiddleware()}, nil
 }
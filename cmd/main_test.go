@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/shotokan/firebase-training/internal/common"
+	"github.com/shotokan/firebase-training/internal/users/adapters"
+	"github.com/shotokan/firebase-training/internal/users/models"
+	"github.com/shotokan/firebase-training/internal/users/ports"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestFakeTokens checks that the tokens printed at startup can do what their
+// names say, against the middleware of main.
+func TestFakeTokens(t *testing.T) {
+	fa, err := common.NewFakeAuthenticator()
+	if err != nil {
+		t.Fatalf("creating fake authenticator: %v", err)
+	}
+	reader, writer, err := CreateFakeTokens(fa)
+	if err != nil {
+		t.Fatalf("creating fake tokens: %v", err)
+	}
+
+	mw, err := CreateMiddleware(common.NewJWSVerifier(fa, common.NewClaimsDecoder(models.RoleUser)))
+	if err != nil {
+		t.Fatalf("creating middleware: %v", err)
+	}
+	hasher, err := adapters.NewBcryptPasswordHasher(bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("creating password hasher: %v", err)
+	}
+	e := echo.New()
+	e.Use(mw...)
+	users := ports.NewHttpServer(adapters.NewUserMemoryRepository(), hasher, ports.NewPageTokenCodec([]byte("test-secret")), ports.DefaultUserPolicies)
+	ports.RegisterHandlers(ports.NewCustomMethodRouter(e), users)
+
+	newUser := `{"name":"amy","email":"amy@example.com","password":"passw0rd!"}`
+	tests := []struct {
+		name       string
+		token      []byte
+		method     string
+		body       string
+		wantStatus int
+		wantSlug   string
+	}{
+		{name: "writer creates a user", token: writer, method: http.MethodPost, body: newUser, wantStatus: http.StatusCreated},
+		{name: "writer lists users", token: writer, method: http.MethodGet, wantStatus: http.StatusOK},
+		{name: "reader lists users", token: reader, method: http.MethodGet, wantStatus: http.StatusOK},
+		{name: "reader creates a user", token: reader, method: http.MethodPost, body: newUser, wantStatus: http.StatusForbidden, wantSlug: "insufficient-scope"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/users", strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			}
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+string(tt.token))
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantSlug == "" {
+				return
+			}
+			var resp ports.Error
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decoding error: %v", err)
+			}
+			if resp.Slug != tt.wantSlug {
+				t.Errorf("got slug %q, want %q", resp.Slug, tt.wantSlug)
+			}
+		})
+	}
+}
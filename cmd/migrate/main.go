@@ -0,0 +1,69 @@
+// Command migrate upgrades all user documents to the current schema version.
+// Runs are resumable, an interrupted run continues where it stopped:
+//
+//	GCP_PROJECT=<project> go run ./cmd/migrate -dry-run
+//	GCP_PROJECT=<project> go run ./cmd/migrate
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"cloud.google.com/go/firestore"
+	"github.com/shotokan/firebase-training/internal/users/adapters"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "Count the users to migrate without writing them")
+	restart := flag.Bool("restart", false, "Scan all users again instead of resuming the previous run")
+	batchSize := flag.Int("batch-size", 200, "Number of users migrated at once")
+	bcryptCost := flag.Int("bcrypt-cost", bcrypt.DefaultCost, "Cost of the bcrypt hashes of plaintext passwords")
+	flag.Parse()
+
+	passwordHasher, err := adapters.NewBcryptPasswordHasher(*bcryptCost)
+	if err != nil {
+		logrus.WithError(err).Fatal("Unable to create password hasher")
+	}
+
+	ctx := context.Background()
+
+	client, err := firestore.NewClient(ctx, os.Getenv("GCP_PROJECT"))
+	if err != nil {
+		logrus.WithError(err).Fatal("Unable to create firestore client")
+	}
+	defer client.Close()
+
+	migrator := adapters.NewUserSchemaMigrator(client, passwordHasher)
+	progress, err := migrator.Migrate(ctx, adapters.UserSchemaMigrationOptions{
+		DryRun:    *dryRun,
+		Restart:   *restart,
+		BatchSize: *batchSize,
+		Progress: func(progress adapters.UserSchemaMigrationProgress) {
+			logrus.WithFields(logrus.Fields{
+				"scanned":         progress.Scanned,
+				"migrated":        progress.Migrated,
+				"skipped":         progress.Skipped,
+				"emails_reserved": progress.EmailsReserved,
+				"email_conflicts": progress.EmailConflicts,
+				"last_user":       progress.LastUserID,
+			}).Info("Migrating users")
+		},
+	})
+
+	log := logrus.WithFields(logrus.Fields{
+		"target_version":  progress.TargetVersion,
+		"scanned":         progress.Scanned,
+		"migrated":        progress.Migrated,
+		"skipped":         progress.Skipped,
+		"emails_reserved": progress.EmailsReserved,
+		"email_conflicts": progress.EmailConflicts,
+		"dry_run":         *dryRun,
+	})
+	if err != nil {
+		log.WithError(err).Fatal("Migration stopped, run again to resume")
+	}
+	log.Info("Users migrated")
+}
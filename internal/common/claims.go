@@ -0,0 +1,159 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	commonerrors "github.com/shotokan/firebase-training/internal/common/errors"
+)
+
+// Claim is a token claim read into User.
+type Claim struct {
+	Name string
+	// Required claims must be in every token, and not empty.
+	Required bool
+}
+
+// ClaimsDecoder reads the User of a verified token from its claims. Claims
+// which aren't required may be missing, but they must have the right type
+// when present.
+type ClaimsDecoder struct {
+	Email       Claim
+	Role        Claim
+	DisplayName Claim
+	// Permissions is a list of strings, or a string of space-separated
+	// values like the OAuth scope claim.
+	Permissions Claim
+	// DefaultRole is the role of users whose token has no role, like Firebase
+	// users without custom claims.
+	DefaultRole string
+}
+
+// NewClaimsDecoder reads the standard email and name claims, the role custom
+// claim and PermissionsClaim, none of them required.
+func NewClaimsDecoder(defaultRole string) ClaimsDecoder {
+	return ClaimsDecoder{
+		Email:       Claim{Name: "email"},
+		Role:        Claim{Name: RoleClaim},
+		DisplayName: Claim{Name: "name"},
+		Permissions: Claim{Name: PermissionsClaim},
+		DefaultRole: defaultRole,
+	}
+}
+
+// Require marks the claims with the given names as required.
+func (d *ClaimsDecoder) Require(names ...string) error {
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		claim := d.claim(name)
+		if claim == nil {
+			return fmt.Errorf("claim %q is not decoded", name)
+		}
+		claim.Required = true
+	}
+
+	return nil
+}
+
+func (d *ClaimsDecoder) claim(name string) *Claim {
+	for _, claim := range []*Claim{&d.Email, &d.Role, &d.DisplayName, &d.Permissions} {
+		if claim.Name == name {
+			return claim
+		}
+	}
+
+	return nil
+}
+
+// Decode fails with an authorization error when the token has no subject,
+// misses a required claim, or has a claim of the wrong type.
+func (d ClaimsDecoder) Decode(subject string, claims map[string]interface{}) (User, error) {
+	if subject == "" {
+		return User{}, errMissingClaim("sub")
+	}
+
+	user := User{UUID: subject}
+	var err error
+
+	if user.Email, err = d.stringClaim(d.Email, claims); err != nil {
+		return User{}, err
+	}
+	if user.Role, err = d.stringClaim(d.Role, claims); err != nil {
+		return User{}, err
+	}
+	if user.Role == "" {
+		user.Role = d.DefaultRole
+	}
+	if user.DisplayName, err = d.stringClaim(d.DisplayName, claims); err != nil {
+		return User{}, err
+	}
+	if user.Permissions, err = d.listClaim(d.Permissions, claims); err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+func (d ClaimsDecoder) stringClaim(claim Claim, claims map[string]interface{}) (string, error) {
+	raw, ok := claims[claim.Name]
+	if !ok || raw == nil {
+		return "", checkMissing(claim)
+	}
+
+	value, ok := raw.(string)
+	if !ok {
+		return "", errInvalidClaim(claim.Name, "a string")
+	}
+	if value == "" {
+		return "", checkMissing(claim)
+	}
+
+	return value, nil
+}
+
+func (d ClaimsDecoder) listClaim(claim Claim, claims map[string]interface{}) ([]string, error) {
+	raw, ok := claims[claim.Name]
+	if !ok || raw == nil {
+		return nil, checkMissing(claim)
+	}
+
+	var values []string
+	switch raw := raw.(type) {
+	case string:
+		values = strings.Fields(raw)
+	case []string:
+		values = raw
+	case []interface{}:
+		values = make([]string, len(raw))
+		for i, rawValue := range raw {
+			value, ok := rawValue.(string)
+			if !ok {
+				return nil, errInvalidClaim(claim.Name, "a list of strings")
+			}
+			values[i] = value
+		}
+	default:
+		return nil, errInvalidClaim(claim.Name, "a list of strings")
+	}
+	if len(values) == 0 {
+		return nil, checkMissing(claim)
+	}
+
+	return values, nil
+}
+
+func checkMissing(claim Claim) error {
+	if claim.Required {
+		return errMissingClaim(claim.Name)
+	}
+
+	return nil
+}
+
+func errMissingClaim(name string) error {
+	return commonerrors.NewAuthorizationError(fmt.Sprintf("token has no %s claim", name), "missing-token-claim")
+}
+
+func errInvalidClaim(name string, want string) error {
+	return commonerrors.NewAuthorizationError(fmt.Sprintf("%s claim of the token is not %s", name, want), "invalid-token-claim")
+}
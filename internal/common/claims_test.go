@@ -0,0 +1,172 @@
+package common_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/shotokan/firebase-training/internal/common"
+	commonerrors "github.com/shotokan/firebase-training/internal/common/errors"
+)
+
+func TestClaimsDecoderDecode(t *testing.T) {
+	renamed := common.NewClaimsDecoder("user")
+	renamed.Email.Name = "mail"
+	renamed.Role.Name = "https://example.com/role"
+	renamed.DisplayName.Name = "nickname"
+	renamed.Permissions.Name = "scope"
+
+	required := common.NewClaimsDecoder("user")
+	if err := required.Require("email", "role"); err != nil {
+		t.Fatalf("requiring claims: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		decoder  common.ClaimsDecoder
+		subject  string
+		claims   map[string]interface{}
+		want     common.User
+		wantSlug string
+	}{
+		{
+			name:    "all claims",
+			decoder: common.NewClaimsDecoder("user"),
+			subject: "amy",
+			claims: map[string]interface{}{
+				"email": "amy@example.com",
+				"role":  "admin",
+				"name":  "Amy",
+				"perm":  []interface{}{"users:read", "users:write"},
+			},
+			want: common.User{UUID: "amy", Email: "amy@example.com", Role: "admin", DisplayName: "Amy", Permissions: []string{"users:read", "users:write"}},
+		},
+		{
+			name:    "missing role falls back to the default role",
+			decoder: common.NewClaimsDecoder("trainer"),
+			subject: "amy",
+			claims:  map[string]interface{}{},
+			want:    common.User{UUID: "amy", Role: "trainer"},
+		},
+		{
+			name:    "empty role falls back to the default role",
+			decoder: common.NewClaimsDecoder("trainer"),
+			subject: "amy",
+			claims:  map[string]interface{}{"role": ""},
+			want:    common.User{UUID: "amy", Role: "trainer"},
+		},
+		{
+			name:    "permissions as a space-separated string",
+			decoder: common.NewClaimsDecoder("user"),
+			subject: "amy",
+			claims:  map[string]interface{}{"perm": "users:read  users:write"},
+			want:    common.User{UUID: "amy", Role: "user", Permissions: []string{"users:read", "users:write"}},
+		},
+		{
+			name:    "permissions as a list of strings",
+			decoder: common.NewClaimsDecoder("user"),
+			subject: "amy",
+			claims:  map[string]interface{}{"perm": []string{"users:read"}},
+			want:    common.User{UUID: "amy", Role: "user", Permissions: []string{"users:read"}},
+		},
+		{
+			name:    "renamed claims",
+			decoder: renamed,
+			subject: "amy",
+			claims: map[string]interface{}{
+				"mail":                     "amy@example.com",
+				"https://example.com/role": "admin",
+				"nickname":                 "Amy",
+				"scope":                    "users:read",
+				"email":                    "ignored@example.com",
+				"role":                     "ignored",
+			},
+			want: common.User{UUID: "amy", Email: "amy@example.com", Role: "admin", DisplayName: "Amy", Permissions: []string{"users:read"}},
+		},
+		{
+			name:     "missing subject",
+			decoder:  common.NewClaimsDecoder("user"),
+			claims:   map[string]interface{}{},
+			wantSlug: "missing-token-claim",
+		},
+		{
+			name:     "missing required claim",
+			decoder:  required,
+			subject:  "amy",
+			claims:   map[string]interface{}{"email": "amy@example.com"},
+			wantSlug: "missing-token-claim",
+		},
+		{
+			name:     "empty required claim",
+			decoder:  required,
+			subject:  "amy",
+			claims:   map[string]interface{}{"email": "", "role": "admin"},
+			wantSlug: "missing-token-claim",
+		},
+		{
+			name:    "required claims present",
+			decoder: required,
+			subject: "amy",
+			claims:  map[string]interface{}{"email": "amy@example.com", "role": "admin"},
+			want:    common.User{UUID: "amy", Email: "amy@example.com", Role: "admin"},
+		},
+		{
+			name:     "role of the wrong type",
+			decoder:  common.NewClaimsDecoder("user"),
+			subject:  "amy",
+			claims:   map[string]interface{}{"role": 42.0},
+			wantSlug: "invalid-token-claim",
+		},
+		{
+			name:     "email of the wrong type",
+			decoder:  common.NewClaimsDecoder("user"),
+			subject:  "amy",
+			claims:   map[string]interface{}{"email": []interface{}{"amy@example.com"}},
+			wantSlug: "invalid-token-claim",
+		},
+		{
+			name:     "permissions of the wrong type",
+			decoder:  common.NewClaimsDecoder("user"),
+			subject:  "amy",
+			claims:   map[string]interface{}{"perm": true},
+			wantSlug: "invalid-token-claim",
+		},
+		{
+			name:     "permissions with a value of the wrong type",
+			decoder:  common.NewClaimsDecoder("user"),
+			subject:  "amy",
+			claims:   map[string]interface{}{"perm": []interface{}{"users:read", 1.0}},
+			wantSlug: "invalid-token-claim",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := tt.decoder.Decode(tt.subject, tt.claims)
+			if tt.wantSlug == "" {
+				if err != nil {
+					t.Fatalf("Decode() = %v, want nil", err)
+				}
+				if !reflect.DeepEqual(user, tt.want) {
+					t.Errorf("Decode() = %+v, want %+v", user, tt.want)
+				}
+				return
+			}
+
+			var slugError commonerrors.SlugError
+			if !errors.As(err, &slugError) {
+				t.Fatalf("Decode() = %v, want a slug error", err)
+			}
+			if slugError.Slug() != tt.wantSlug || slugError.ErrorType() != commonerrors.ErrorTypeAuthorization {
+				t.Errorf("Decode() = %v (%v), want an authorization %s error", slugError.Slug(), slugError.ErrorType(), tt.wantSlug)
+			}
+		})
+	}
+}
+
+func TestClaimsDecoderRequireUnknownClaim(t *testing.T) {
+	decoder := common.NewClaimsDecoder("user")
+	if err := decoder.Require("email", "phone"); err == nil {
+		t.Error("Require() of a claim which isn't decoded = nil, want an error")
+	}
+}
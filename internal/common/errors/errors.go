@@ -5,9 +5,14 @@ type ErrorType struct {
 }
 
 var (
-	ErrorTypeUnknown        = ErrorType{"unknown"}
-	ErrorTypeAuthorization  = ErrorType{"authorization"}
-	ErrorTypeIncorrectInput = ErrorType{"incorrect-input"}
+	ErrorTypeUnknown            = ErrorType{"unknown"}
+	ErrorTypeAuthorization      = ErrorType{"authorization"}
+	ErrorTypeForbidden          = ErrorType{"forbidden"}
+	ErrorTypeIncorrectInput     = ErrorType{"incorrect-input"}
+	ErrorTypeNotFound           = ErrorType{"not-found"}
+	ErrorTypeConflict           = ErrorType{"conflict"}
+	ErrorTypePreconditionFailed = ErrorType{"precondition-failed"}
+	ErrorTypeUnprocessable      = ErrorType{"unprocessable"}
 )
 
 type SlugError struct {
@@ -44,6 +49,16 @@ func NewAuthorizationError(error string, slug string) SlugError {
 	}
 }
 
+// NewForbiddenError is for authenticated users which aren't allowed to do
+// something, unlike NewAuthorizationError for users which aren't known.
+func NewForbiddenError(error string, slug string) SlugError {
+	return SlugError{
+		error:     error,
+		slug:      slug,
+		errorType: ErrorTypeForbidden,
+	}
+}
+
 func NewIncorrectInputError(error string, slug string) SlugError {
 	return SlugError{
 		error:     error,
@@ -51,3 +66,35 @@ func NewIncorrectInputError(error string, slug string) SlugError {
 		errorType: ErrorTypeIncorrectInput,
 	}
 }
+
+func NewNotFoundError(error string, slug string) SlugError {
+	return SlugError{
+		error:     error,
+		slug:      slug,
+		errorType: ErrorTypeNotFound,
+	}
+}
+
+func NewConflictError(error string, slug string) SlugError {
+	return SlugError{
+		error:     error,
+		slug:      slug,
+		errorType: ErrorTypeConflict,
+	}
+}
+
+func NewPreconditionFailedError(error string, slug string) SlugError {
+	return SlugError{
+		error:     error,
+		slug:      slug,
+		errorType: ErrorTypePreconditionFailed,
+	}
+}
+
+func NewUnprocessableError(error string, slug string) SlugError {
+	return SlugError{
+		error:     error,
+		slug:      slug,
+		errorType: ErrorTypeUnprocessable,
+	}
+}
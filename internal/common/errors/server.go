@@ -1,21 +1,115 @@
 package errors
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
 )
 
+func InternalError(slug string, err error) *echo.HTTPError {
+	return httpRespondWithError(err, slug, "Internal server error", http.StatusInternalServerError)
+}
+
 func Unauthorised(slug string, err error) *echo.HTTPError {
-	return httpRespondWithError(err, slug, http.StatusUnauthorized)
+	return httpRespondWithError(err, slug, "Please provide valid credentials", http.StatusUnauthorized)
+}
+
+func Forbidden(slug string, err error) *echo.HTTPError {
+	return httpRespondWithError(err, slug, errorMessage(err), http.StatusForbidden)
+}
+
+func BadRequest(slug string, err error) *echo.HTTPError {
+	return httpRespondWithError(err, slug, errorMessage(err), http.StatusBadRequest)
+}
+
+func NotFound(slug string, err error) *echo.HTTPError {
+	return httpRespondWithError(err, slug, errorMessage(err), http.StatusNotFound)
+}
+
+func MethodNotAllowed(slug string, err error) *echo.HTTPError {
+	return httpRespondWithError(err, slug, errorMessage(err), http.StatusMethodNotAllowed)
+}
+
+func Conflict(slug string, err error) *echo.HTTPError {
+	return httpRespondWithError(err, slug, errorMessage(err), http.StatusConflict)
+}
+
+func Unprocessable(slug string, err error) *echo.HTTPError {
+	return httpRespondWithError(err, slug, errorMessage(err), http.StatusUnprocessableEntity)
+}
+
+func NotAcceptable(slug string, err error) *echo.HTTPError {
+	return httpRespondWithError(err, slug, errorMessage(err), http.StatusNotAcceptable)
+}
+
+func PreconditionFailed(slug string, err error) *echo.HTTPError {
+	return httpRespondWithError(err, slug, errorMessage(err), http.StatusPreconditionFailed)
+}
+
+// RespondWithSlugError maps a SlugError to the HTTP error matching its type.
+// Any other error is reported as an internal error, without leaking details.
+func RespondWithSlugError(err error) *echo.HTTPError {
+	var slugError SlugError
+	if !errors.As(err, &slugError) {
+		return InternalError("internal-server-error", err)
+	}
+
+	switch slugError.ErrorType() {
+	case ErrorTypeAuthorization:
+		return Unauthorised(slugError.Slug(), slugError)
+	case ErrorTypeForbidden:
+		return Forbidden(slugError.Slug(), slugError)
+	case ErrorTypeIncorrectInput:
+		return BadRequest(slugError.Slug(), slugError)
+	case ErrorTypeNotFound:
+		return NotFound(slugError.Slug(), slugError)
+	case ErrorTypeConflict:
+		return Conflict(slugError.Slug(), slugError)
+	case ErrorTypePreconditionFailed:
+		return PreconditionFailed(slugError.Slug(), slugError)
+	case ErrorTypeUnprocessable:
+		return Unprocessable(slugError.Slug(), slugError)
+	default:
+		return InternalError(slugError.Slug(), slugError)
+	}
+}
+
+// SlugErrorResponse renders err like RespondWithSlugError does, for errors
+// reported inside a successful response, like the items of a batch.
+func SlugErrorResponse(err error) ErrorResponse {
+	return RespondWithSlugError(err).Message.(ErrorResponse)
+}
+
+func httpRespondWithError(err error, slug string, message string, status int) *echo.HTTPError {
+	logrus.WithError(err).WithField("error-slug", slug).Warn("HTTP error")
+
+	resp := ErrorResponse{Slug: slug, Message: message, httpStatus: status}
+
+	// echo renders the internal error instead when it's an HTTPError itself,
+	// like the errors of Bind, which would drop the slug. Wrapping hides it.
+	if _, ok := err.(*echo.HTTPError); ok {
+		err = fmt.Errorf("%w", err)
+	}
+
+	return echo.NewHTTPError(status, resp).SetInternal(err)
 }
 
-func httpRespondWithError(err error, slug string, status int) *echo.HTTPError {
-	return echo.NewHTTPError(http.StatusUnauthorized, "Please provide valid credentials")
+// errorMessage is the message of err for clients, without the status code
+// and internal error echo adds to the messages of its HTTPErrors.
+func errorMessage(err error) string {
+	if httpError, ok := err.(*echo.HTTPError); ok {
+		return fmt.Sprint(httpError.Message)
+	}
 
+	return err.Error()
 }
 
+// ErrorResponse is rendered with the same shape as the Error schema of the API.
 type ErrorResponse struct {
 	Slug       string `json:"slug"`
+	Message    string `json:"message"`
 	httpStatus int
 }
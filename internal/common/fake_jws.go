@@ -28,8 +28,15 @@ s9SlG/8hjB2Hz42v4p3haKWv3uS1C6ahCQ==
 const KeyID = `fake-key-id`
 const FakeIssuer = "fake-issuer"
 const FakeAudience = "example-users"
+
+// FakeSubject is the user the tokens of CreateJWSWithClaims are issued to.
+const FakeSubject = "fake-user"
 const PermissionsClaim = "perm"
 
+// RoleClaim is the claim holding the role of the user, unless ClaimsDecoder
+// is told otherwise.
+const RoleClaim = "role"
+
 type FakeAuthenticator struct {
 	PrivateKey *ecdsa.PrivateKey
 	KeySet     jwk.Set
@@ -91,8 +98,8 @@ func (f *FakeAuthenticator) SignToken(t jwt.Token) ([]byte, error) {
 }
 
 // CreateJWSWithClaims is a helper function to create JWT's with the specified
-// claims.
-func (f *FakeAuthenticator) CreateJWSWithClaims(claims []string) ([]byte, error) {
+// role and claims.
+func (f *FakeAuthenticator) CreateJWSWithClaims(role string, claims []string) ([]byte, error) {
 	t := jwt.New()
 	err := t.Set(jwt.IssuerKey, FakeIssuer)
 	if err != nil {
@@ -102,6 +109,14 @@ func (f *FakeAuthenticator) CreateJWSWithClaims(claims []string) ([]byte, error)
 	if err != nil {
 		return nil, fmt.Errorf("setting audience: %w", err)
 	}
+	err = t.Set(jwt.SubjectKey, FakeSubject)
+	if err != nil {
+		return nil, fmt.Errorf("setting subject: %w", err)
+	}
+	err = t.Set(RoleClaim, role)
+	if err != nil {
+		return nil, fmt.Errorf("setting role: %w", err)
+	}
 	err = t.Set(PermissionsClaim, claims)
 	if err != nil {
 		return nil, fmt.Errorf("setting permissions: %w", err)
@@ -0,0 +1,88 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// firestoreRecord is the document of an idempotency key. Firestore deletes
+// it once expiresAt is past, given a TTL policy on the field.
+type firestoreRecord struct {
+	Fingerprint string              `firestore:"fingerprint"`
+	ExpiresAt   time.Time           `firestore:"expiresAt"`
+	Completed   bool                `firestore:"completed"`
+	StatusCode  int                 `firestore:"statusCode"`
+	Header      map[string][]string `firestore:"header"`
+	Body        []byte              `firestore:"body"`
+}
+
+// FirestoreStore keeps idempotency keys in a Firestore collection, shared by
+// all instances.
+type FirestoreStore struct {
+	firestoreClient *firestore.Client
+	collection      string
+}
+
+func NewFirestoreStore(firestoreClient *firestore.Client, collection string) *FirestoreStore {
+	return &FirestoreStore{
+		firestoreClient: firestoreClient,
+		collection:      collection,
+	}
+}
+
+func (s FirestoreStore) Reserve(ctx context.Context, key string, fingerprint string, expiresAt time.Time) (*Response, error) {
+	docRef := s.firestoreClient.Collection(s.collection).Doc(key)
+
+	var response *Response
+	err := s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		response = nil
+
+		doc, err := tx.Get(docRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		if err == nil {
+			record := firestoreRecord{}
+			if err := doc.DataTo(&record); err != nil {
+				return err
+			}
+
+			// TTL deletion is lazy, expired records may still be around.
+			if time.Now().Before(record.ExpiresAt) {
+				var stored *Response
+				if record.Completed {
+					stored = &Response{StatusCode: record.StatusCode, Header: http.Header(record.Header), Body: record.Body}
+				}
+				response, err = checkRecord(record.Fingerprint, fingerprint, stored)
+				return err
+			}
+		}
+
+		return tx.Set(docRef, firestoreRecord{Fingerprint: fingerprint, ExpiresAt: expiresAt})
+	})
+
+	return response, err
+}
+
+func (s FirestoreStore) Complete(ctx context.Context, key string, response Response) error {
+	_, err := s.firestoreClient.Collection(s.collection).Doc(key).Update(ctx, []firestore.Update{
+		{Path: "completed", Value: true},
+		{Path: "statusCode", Value: response.StatusCode},
+		{Path: "header", Value: map[string][]string(response.Header)},
+		{Path: "body", Value: response.Body},
+	})
+
+	return err
+}
+
+func (s FirestoreStore) Release(ctx context.Context, key string) error {
+	_, err := s.firestoreClient.Collection(s.collection).Doc(key).Delete(ctx)
+
+	return err
+}
@@ -0,0 +1,200 @@
+// Package idempotency makes retries of mutation requests safe. Clients send an
+// Idempotency-Key header, and the response to the first request with a key is
+// replayed to every retry with the same key.
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/shotokan/firebase-training/internal/common"
+	commonerrors "github.com/shotokan/firebase-training/internal/common/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed marks the responses replayed from the store.
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+	DefaultTTL   = 24 * time.Hour
+)
+
+var errInvalidKey = commonerrors.NewIncorrectInputError(
+	"Idempotency-Key must have between 1 and 255 characters",
+	"invalid-idempotency-key",
+)
+
+type Config struct {
+	// Skipper selects the requests which don't honour Idempotency-Key, see
+	// OnlyRoutes.
+	Skipper middleware.Skipper
+	Store   Store
+	// TTL is how long keys are kept, DefaultTTL when zero.
+	TTL time.Duration
+}
+
+// OnlyRoutes is a Skipper opting in the routes given as "METHOD path", with
+// the path as registered in echo, like "POST /users".
+func OnlyRoutes(routes ...string) middleware.Skipper {
+	optedIn := map[string]bool{}
+	for _, route := range routes {
+		optedIn[route] = true
+	}
+
+	return func(c echo.Context) bool {
+		return !optedIn[c.Request().Method+" "+c.Path()]
+	}
+}
+
+// Middleware stores the response to the first request with an
+// Idempotency-Key and replays it for the retries. The same key sent with a
+// different request is rejected with 422, and a retry arriving while the
+// first request is still being served with 409. Server errors aren't
+// stored, so the request can be retried with the same key.
+//
+// Keys are scoped to the authenticated user, so the middleware must run
+// after authentication.
+func Middleware(config Config) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.TTL == 0 {
+		config.TTL = DefaultTTL
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(HeaderIdempotencyKey)
+			if config.Skipper(c) || key == "" {
+				return next(c)
+			}
+			if len(key) > maxKeyLength {
+				return commonerrors.RespondWithSlugError(errInvalidKey)
+			}
+
+			fingerprint, err := requestFingerprint(c.Request())
+			if err != nil {
+				return commonerrors.InternalError("unable-to-read-request", err)
+			}
+
+			ctx := c.Request().Context()
+			storeKey := scopedKey(c, key)
+
+			stored, err := config.Store.Reserve(ctx, storeKey, fingerprint, time.Now().Add(config.TTL))
+			if err != nil {
+				return commonerrors.RespondWithSlugError(err)
+			}
+			if stored != nil {
+				return replay(c, *stored)
+			}
+
+			response, err := capture(c, next)
+			if err != nil {
+				if releaseErr := config.Store.Release(ctx, storeKey); releaseErr != nil {
+					logrus.WithError(releaseErr).Warn("Unable to release idempotency key")
+				}
+				return err
+			}
+
+			if response.StatusCode >= http.StatusInternalServerError {
+				err = config.Store.Release(ctx, storeKey)
+			} else {
+				err = config.Store.Complete(ctx, storeKey, response)
+			}
+			if err != nil {
+				// The response is sent already, a retry will find the key
+				// in progress until it expires.
+				logrus.WithError(err).Error("Unable to store idempotent response")
+			}
+
+			return nil
+		}
+	}
+}
+
+// requestFingerprint identifies the request a key was first used with. The
+// body is read whole, and put back for the handler.
+func requestFingerprint(r *http.Request) (string, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// scopedKey keeps the keys of different users apart, so a user can't replay
+// the responses of another one.
+func scopedKey(c echo.Context, key string) string {
+	principal := ""
+	if user, err := common.UserFromCtx(c.Request().Context()); err == nil {
+		principal = user.UUID
+	}
+
+	hash := sha256.Sum256([]byte(principal + "\n" + key))
+
+	return hex.EncodeToString(hash[:])
+}
+
+func replay(c echo.Context, stored Response) error {
+	header := c.Response().Header()
+	for name, values := range stored.Header {
+		header[name] = values
+	}
+	header.Set(HeaderIdempotentReplayed, "true")
+
+	c.Response().WriteHeader(stored.StatusCode)
+	_, err := c.Response().Write(stored.Body)
+
+	return err
+}
+
+// capture serves the request, keeping a copy of the response. Handler errors
+// are rendered by the echo error handler here, so they are captured too.
+// The returned error is only set when no response was written.
+func capture(c echo.Context, next echo.HandlerFunc) (Response, error) {
+	recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+	c.Response().Writer = recorder
+	defer func() {
+		c.Response().Writer = recorder.ResponseWriter
+	}()
+
+	if err := next(c); err != nil {
+		if c.Response().Committed {
+			return Response{}, err
+		}
+		c.Error(err)
+	}
+	if !c.Response().Committed {
+		return Response{}, echo.ErrInternalServerError
+	}
+
+	return Response{
+		StatusCode: c.Response().Status,
+		Header:     c.Response().Header().Clone(),
+		Body:       recorder.body.Bytes(),
+	}, nil
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
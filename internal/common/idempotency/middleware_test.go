@@ -0,0 +1,234 @@
+package idempotency_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/shotokan/firebase-training/internal/common"
+	"github.com/shotokan/firebase-training/internal/common/idempotency"
+)
+
+// testServer serves POST /users behind the middleware, with the user of the
+// X-Test-User header authenticated.
+type testServer struct {
+	e *echo.Echo
+
+	lock  sync.Mutex
+	calls int
+	// status is the status of the next responses of the handler.
+	status int
+	// block, when set, holds the handler until it is closed.
+	block chan struct{}
+	// started is signalled once the handler is called.
+	started chan struct{}
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	s := &testServer{e: echo.New(), status: http.StatusCreated}
+	s.e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if subject := c.Request().Header.Get("X-Test-User"); subject != "" {
+				user := common.User{UUID: subject}
+				c.SetRequest(c.Request().WithContext(common.WithUser(c.Request().Context(), user)))
+			}
+			return next(c)
+		}
+	})
+	s.e.Use(idempotency.Middleware(idempotency.Config{
+		Skipper: idempotency.OnlyRoutes("POST /users"),
+		Store:   idempotency.NewMemoryStore(),
+	}))
+
+	handler := func(c echo.Context) error {
+		s.lock.Lock()
+		s.calls++
+		calls, status, block, started := s.calls, s.status, s.block, s.started
+		s.lock.Unlock()
+
+		if started != nil {
+			started <- struct{}{}
+		}
+		if block != nil {
+			<-block
+		}
+
+		return c.JSON(status, map[string]int{"call": calls})
+	}
+	s.e.POST("/users", handler)
+	s.e.POST("/other", handler)
+
+	return s
+}
+
+func (s *testServer) post(path string, user string, key string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if user != "" {
+		req.Header.Set("X-Test-User", user)
+	}
+	if key != "" {
+		req.Header.Set(idempotency.HeaderIdempotencyKey, key)
+	}
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func (s *testServer) callCount() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.calls
+}
+
+func TestMiddlewareReplaysResponse(t *testing.T) {
+	s := newTestServer(t)
+
+	first := s.post("/users", "amy", "key-1", `{"name":"amy"}`)
+	retry := s.post("/users", "amy", "key-1", `{"name":"amy"}`)
+
+	if s.callCount() != 1 {
+		t.Fatalf("handler called %d times, want 1", s.callCount())
+	}
+	if first.Code != http.StatusCreated || first.Header().Get(idempotency.HeaderIdempotentReplayed) != "" {
+		t.Errorf("first response: status %d, replayed %q", first.Code, first.Header().Get(idempotency.HeaderIdempotentReplayed))
+	}
+	if retry.Code != http.StatusCreated || retry.Header().Get(idempotency.HeaderIdempotentReplayed) != "true" {
+		t.Errorf("retry: status %d, replayed %q, want %d replayed", retry.Code, retry.Header().Get(idempotency.HeaderIdempotentReplayed), http.StatusCreated)
+	}
+	if retry.Body.String() != first.Body.String() {
+		t.Errorf("retry body %q, want %q", retry.Body, first.Body)
+	}
+	if retry.Header().Get(echo.HeaderContentType) != first.Header().Get(echo.HeaderContentType) {
+		t.Errorf("retry Content-Type %q, want %q", retry.Header().Get(echo.HeaderContentType), first.Header().Get(echo.HeaderContentType))
+	}
+}
+
+func TestMiddlewareRejectsKeyReusedWithAnotherBody(t *testing.T) {
+	s := newTestServer(t)
+
+	s.post("/users", "amy", "key-1", `{"name":"amy"}`)
+	rec := s.post("/users", "amy", "key-1", `{"name":"bo"}`)
+
+	expectError(t, rec, http.StatusUnprocessableEntity, "idempotency-key-reused")
+	if s.callCount() != 1 {
+		t.Errorf("handler called %d times, want 1", s.callCount())
+	}
+}
+
+func TestMiddlewareRejectsRetryInProgress(t *testing.T) {
+	s := newTestServer(t)
+	s.block = make(chan struct{})
+	s.started = make(chan struct{}, 1)
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() {
+		first <- s.post("/users", "amy", "key-1", `{"name":"amy"}`)
+	}()
+	<-s.started
+
+	rec := s.post("/users", "amy", "key-1", `{"name":"amy"}`)
+	expectError(t, rec, http.StatusConflict, "idempotent-request-in-progress")
+
+	close(s.block)
+	if rec := <-first; rec.Code != http.StatusCreated {
+		t.Errorf("first response: status %d, want %d", rec.Code, http.StatusCreated)
+	}
+}
+
+func TestMiddlewareReleasesKeyAfterServerError(t *testing.T) {
+	s := newTestServer(t)
+	s.status = http.StatusServiceUnavailable
+
+	if rec := s.post("/users", "amy", "key-1", `{"name":"amy"}`); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("first response: status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	s.status = http.StatusCreated
+	retry := s.post("/users", "amy", "key-1", `{"name":"amy"}`)
+
+	if retry.Code != http.StatusCreated || retry.Header().Get(idempotency.HeaderIdempotentReplayed) != "" {
+		t.Errorf("retry: status %d, replayed %q, want %d served again", retry.Code, retry.Header().Get(idempotency.HeaderIdempotentReplayed), http.StatusCreated)
+	}
+	if s.callCount() != 2 {
+		t.Errorf("handler called %d times, want 2", s.callCount())
+	}
+}
+
+func TestMiddlewareKeepsClientErrors(t *testing.T) {
+	s := newTestServer(t)
+	s.status = http.StatusBadRequest
+
+	s.post("/users", "amy", "key-1", `{"name":"amy"}`)
+	retry := s.post("/users", "amy", "key-1", `{"name":"amy"}`)
+
+	if retry.Code != http.StatusBadRequest || retry.Header().Get(idempotency.HeaderIdempotentReplayed) != "true" {
+		t.Errorf("retry: status %d, replayed %q, want %d replayed", retry.Code, retry.Header().Get(idempotency.HeaderIdempotentReplayed), http.StatusBadRequest)
+	}
+}
+
+func TestMiddlewareScopesKeysPerUser(t *testing.T) {
+	s := newTestServer(t)
+
+	s.post("/users", "amy", "key-1", `{"name":"amy"}`)
+	other := s.post("/users", "bo", "key-1", `{"name":"amy"}`)
+
+	if other.Code != http.StatusCreated || other.Header().Get(idempotency.HeaderIdempotentReplayed) != "" {
+		t.Errorf("other user: status %d, replayed %q, want %d served", other.Code, other.Header().Get(idempotency.HeaderIdempotentReplayed), http.StatusCreated)
+	}
+	if s.callCount() != 2 {
+		t.Errorf("handler called %d times, want 2", s.callCount())
+	}
+}
+
+func TestMiddlewareSkipsRequestsWithoutKeyOrRoute(t *testing.T) {
+	s := newTestServer(t)
+
+	s.post("/users", "amy", "", `{"name":"amy"}`)
+	s.post("/users", "amy", "", `{"name":"amy"}`)
+	s.post("/other", "amy", "key-1", `{"name":"amy"}`)
+	rec := s.post("/other", "amy", "key-1", `{"name":"amy"}`)
+
+	if s.callCount() != 4 {
+		t.Errorf("handler called %d times, want 4", s.callCount())
+	}
+	if rec.Header().Get(idempotency.HeaderIdempotentReplayed) != "" {
+		t.Errorf("route which didn't opt in was replayed")
+	}
+}
+
+func TestMiddlewareRejectsLongKey(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := s.post("/users", "amy", strings.Repeat("k", 256), `{"name":"amy"}`)
+
+	expectError(t, rec, http.StatusBadRequest, "invalid-idempotency-key")
+	if s.callCount() != 0 {
+		t.Errorf("handler called %d times, want 0", s.callCount())
+	}
+}
+
+func expectError(t *testing.T, rec *httptest.ResponseRecorder, wantStatus int, wantSlug string) {
+	t.Helper()
+
+	if rec.Code != wantStatus {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, wantStatus, rec.Body)
+	}
+	var resp struct {
+		Slug string `json:"slug"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding error: %v", err)
+	}
+	if resp.Slug != wantSlug {
+		t.Errorf("got slug %q, want %q", resp.Slug, wantSlug)
+	}
+}
@@ -0,0 +1,108 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	commonerrors "github.com/shotokan/firebase-training/internal/common/errors"
+)
+
+var (
+	ErrKeyReused = commonerrors.NewUnprocessableError(
+		"idempotency key was already used for a different request",
+		"idempotency-key-reused",
+	)
+	ErrRequestInProgress = commonerrors.NewConflictError(
+		"a request with this idempotency key is still in progress",
+		"idempotent-request-in-progress",
+	)
+)
+
+// Response is the response stored for an idempotency key, replayed to the
+// retries of the request.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Store keeps the requests made with idempotency keys until they expire.
+type Store interface {
+	// Reserve claims key for the request with fingerprint, until expiresAt.
+	// It returns the stored response when the request was completed before,
+	// ErrKeyReused when key belongs to another request, and
+	// ErrRequestInProgress while the first request is still being served.
+	Reserve(ctx context.Context, key string, fingerprint string, expiresAt time.Time) (*Response, error)
+	// Complete stores the response of the request reserving key.
+	Complete(ctx context.Context, key string, response Response) error
+	// Release frees key, so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+type memoryRecord struct {
+	fingerprint string
+	expiresAt   time.Time
+	response    *Response
+}
+
+// MemoryStore keeps idempotency keys in process memory, for a single
+// instance.
+type MemoryStore struct {
+	records map[string]memoryRecord
+	lock    *sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: map[string]memoryRecord{},
+		lock:    &sync.Mutex{},
+	}
+}
+
+func (s MemoryStore) Reserve(_ context.Context, key string, fingerprint string, expiresAt time.Time) (*Response, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	record, ok := s.records[key]
+	if ok && time.Now().Before(record.expiresAt) {
+		return checkRecord(record.fingerprint, fingerprint, record.response)
+	}
+
+	s.records[key] = memoryRecord{fingerprint: fingerprint, expiresAt: expiresAt}
+
+	return nil, nil
+}
+
+func (s MemoryStore) Complete(_ context.Context, key string, response Response) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	record := s.records[key]
+	record.response = &response
+	s.records[key] = record
+
+	return nil
+}
+
+func (s MemoryStore) Release(_ context.Context, key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.records, key)
+
+	return nil
+}
+
+// checkRecord decides what to do with a request for a key reserved before.
+func checkRecord(storedFingerprint string, fingerprint string, response *Response) (*Response, error) {
+	if storedFingerprint != fingerprint {
+		return nil, ErrKeyReused
+	}
+	if response == nil {
+		return nil, ErrRequestInProgress
+	}
+
+	return response, nil
+}
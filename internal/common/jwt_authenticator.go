@@ -7,8 +7,8 @@ import (
 	"net/http"
 	"strings"
 
-	"firebase.google.com/go/auth"
 	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/labstack/echo/v4"
 	"github.com/lestrrat-go/jwx/jwt"
 	middleware "github.com/oapi-codegen/echo-middleware"
 	commonerrors "github.com/shotokan/firebase-training/internal/common/errors"
@@ -20,13 +20,15 @@ type JWSValidator interface {
 	ValidateJWS(jws string) (jwt.Token, error)
 }
 
-const JWTClaimsContextKey = "jwt_claims"
+// UserContextKey is the key of the User in echo contexts, see UserFromEchoCtx.
 const UserContextKey = "user"
 
+// userContextKey is the key of the User in context.Context, see WithUser.
+type userContextKey struct{}
+
 var (
 	ErrNoAuthHeader      = errors.New("Authorization header is missing")
 	ErrInvalidAuthHeader = errors.New("Authorization header is malformed")
-	ErrClaimsInvalid     = errors.New("Provided claims do not match expected scopes")
 )
 
 // GetJWSFromRequest extracts a JWS string from an Authorization: Bearer <jws> header
@@ -45,15 +47,16 @@ func GetJWSFromRequest(req *http.Request) (string, error) {
 	return strings.TrimPrefix(authHdr, prefix), nil
 }
 
-func NewAuthenticator(v JWSValidator, authClient *auth.Client) openapi3filter.AuthenticationFunc {
+func NewAuthenticator(verifier TokenVerifier) openapi3filter.AuthenticationFunc {
 	return func(ctx context.Context, input *openapi3filter.AuthenticationInput) error {
-		return Authenticate(v, ctx, input, authClient)
+		return Authenticate(verifier, ctx, input)
 	}
 }
 
-// Authenticate uses the specified validator to ensure a JWT is valid, then makes
-// sure that the claims provided by the JWT match the scopes as required in the API.
-func Authenticate(v JWSValidator, ctx context.Context, input *openapi3filter.AuthenticationInput, authClient *auth.Client) error {
+// Authenticate uses the specified verifier to ensure the bearer token is
+// valid, whichever auth mode the verifier implements, then makes sure that the
+// permissions of the user cover the scopes required by the API.
+func Authenticate(verifier TokenVerifier, ctx context.Context, input *openapi3filter.AuthenticationInput) error {
 	// Our security scheme is named BearerAuth, ensure this is the case
 	if !strings.EqualFold(input.SecuritySchemeName, "BearerAuth") {
 		return fmt.Errorf("security scheme %s != 'BearerAuth'", input.SecuritySchemeName)
@@ -63,79 +66,50 @@ func Authenticate(v JWSValidator, ctx context.Context, input *openapi3filter.Aut
 	// against request contents.
 	jws, err := GetJWSFromRequest(input.RequestValidationInput.Request)
 	if err != nil {
-		return fmt.Errorf("getting jws: %w", err)
+		return commonerrors.Unauthorised("missing-bearer-token", fmt.Errorf("getting jws: %w", err))
 	}
 
-	// if the JWS is valid, we have a JWT, which will contain a bunch of claims.
-	token, err := authClient.VerifyIDToken(ctx, jws)
+	// if the token is valid, we have the user it was issued to.
+	user, err := verifier.VerifyToken(ctx, jws)
+	var slugError commonerrors.SlugError
+	if errors.As(err, &slugError) {
+		// The token is genuine, but its claims don't describe a user.
+		return commonerrors.RespondWithSlugError(slugError)
+	}
 	if err != nil {
 		return commonerrors.Unauthorised("unable-to-verify-jwt", err)
 	}
 
-	// Set the property on the echo context so the handler is able to
-	// access the claims data we generate in here.
+	// The scopes of the operation, declared in the API spec. A genuine token
+	// without them gets 403, not 401.
+	if err := CheckScopes(input.Scopes, user.Permissions); err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
 
+	// Set the property on the echo context, UserContextMiddleware passes it
+	// on to the request context the handler gets.
 	eCtx := middleware.GetEchoContext(ctx)
-	eCtx.Set(JWTClaimsContextKey, token)
-	eCtx.Set(UserContextKey, token)
-	ctx = context.WithValue(ctx, UserContextKey, User{
-		UUID:        token.UID,
-		Email:       token.Claims["email"].(string),
-		Role:        token.Claims["role"].(string),
-		DisplayName: token.Claims["name"].(string),
-	})
+	eCtx.Set(UserContextKey, user)
 
 	return nil
 }
 
-// GetClaimsFromToken returns a list of claims from the token. We store these
-// as a list under the "perms" claim, short for permissions, to keep the token
-// shorter.
-func GetClaimsFromToken(t jwt.Token) ([]string, error) {
-	rawPerms, found := t.Get(PermissionsClaim)
-	if !found {
-		// If the perms aren't found, it means that the token has none, but it has
-		// passed signature validation by now, so it's a valid token, so we return
-		// the empty list.
-		return make([]string, 0), nil
-	}
-
-	// rawPerms will be an untyped JSON list, so we need to convert it to
-	// a string list.
-	rawList, ok := rawPerms.([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("'%s' claim is unexpected type'", PermissionsClaim)
-	}
-
-	claims := make([]string, len(rawList))
-
-	for i, rawClaim := range rawList {
-		var ok bool
-		claims[i], ok = rawClaim.(string)
-		if !ok {
-			return nil, fmt.Errorf("%s[%d] is not a string", PermissionsClaim, i)
-		}
-	}
-	return claims, nil
-}
-
-func CheckTokenClaims(expectedClaims []string, t jwt.Token) error {
-	claims, err := GetClaimsFromToken(t)
-	if err != nil {
-		return fmt.Errorf("getting claims from token: %w", err)
-	}
-	// Put the claims into a map, for quick access.
-	claimsMap := make(map[string]bool, len(claims))
-	for _, c := range claims {
-		claimsMap[c] = true
-	}
-
-	for _, e := range expectedClaims {
-		if !claimsMap[e] {
-			return ErrClaimsInvalid
+// UserContextMiddleware moves the user set by Authenticate from the echo
+// context to the request context, where UserFromCtx finds it, so it reaches
+// handlers and everything they call. It must run right after the request
+// validator. Authenticate can't do it itself: the validator reads the body
+// after authenticating, from the request it started with, so the request
+// must not be replaced meanwhile.
+func UserContextMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if user, ok := c.Get(UserContextKey).(User); ok {
+				c.SetRequest(c.Request().WithContext(WithUser(c.Request().Context(), user)))
+			}
+
+			return next(c)
 		}
 	}
-	return nil
 }
 
 func tokenFromHeader(r *http.Request) string {
@@ -148,12 +122,16 @@ func tokenFromHeader(r *http.Request) string {
 	return ""
 }
 
+// User is the authenticated principal, the same whichever TokenVerifier
+// accepted its token.
 type User struct {
 	UUID  string
 	Email string
 	Role  string
 
 	DisplayName string
+	// Permissions are the values of the PermissionsClaim of the token.
+	Permissions []string
 }
 
 var (
@@ -162,11 +140,27 @@ var (
 	NoUserInContextError = commonerrors.NewAuthorizationError("no user in context", "no-user-found")
 )
 
+// WithUser returns a copy of ctx carrying user, as the principal of the
+// operations done with it.
+func WithUser(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
 func UserFromCtx(ctx context.Context) (User, error) {
-	u, ok := ctx.Value(UserContextKey).(User)
+	u, ok := ctx.Value(userContextKey{}).(User)
 	if ok {
 		return u, nil
 	}
 
 	return User{}, NoUserInContextError
 }
+
+// UserFromEchoCtx returns the user of a request, set on the echo context by
+// Authenticate or on the request context.
+func UserFromEchoCtx(c echo.Context) (User, error) {
+	if u, ok := c.Get(UserContextKey).(User); ok {
+		return u, nil
+	}
+
+	return UserFromCtx(c.Request().Context())
+}
@@ -0,0 +1,46 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	commonerrors "github.com/shotokan/firebase-training/internal/common/errors"
+)
+
+// scopeSeparator splits scopes into levels, like users:profile:write.
+const scopeSeparator = ":"
+
+// ScopeGrants reports whether the granted scope covers the required one.
+// Scopes are hierarchical: users:profile covers users:profile:write, and
+// users:* covers every scope under users, as * covers all scopes.
+func ScopeGrants(granted string, required string) bool {
+	if granted == "*" || granted == required {
+		return true
+	}
+
+	if prefix, ok := strings.CutSuffix(granted, scopeSeparator+"*"); ok {
+		return strings.HasPrefix(required, prefix+scopeSeparator)
+	}
+
+	return strings.HasPrefix(required, granted+scopeSeparator)
+}
+
+// CheckScopes fails with a forbidden error unless every required scope is
+// covered by one of the granted ones.
+func CheckScopes(required []string, granted []string) error {
+	for _, r := range required {
+		covered := false
+		for _, g := range granted {
+			if ScopeGrants(g, r) {
+				covered = true
+				break
+			}
+		}
+
+		if !covered {
+			return commonerrors.NewForbiddenError(fmt.Sprintf("token lacks the %s scope", r), "insufficient-scope")
+		}
+	}
+
+	return nil
+}
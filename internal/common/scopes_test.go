@@ -0,0 +1,78 @@
+package common_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shotokan/firebase-training/internal/common"
+	commonerrors "github.com/shotokan/firebase-training/internal/common/errors"
+)
+
+func TestScopeGrants(t *testing.T) {
+	tests := []struct {
+		granted  string
+		required string
+		want     bool
+	}{
+		{granted: "*", required: "users:read", want: true},
+		{granted: "*", required: "users:profile:write", want: true},
+		{granted: "users:read", required: "users:read", want: true},
+		{granted: "users:read", required: "users:write", want: false},
+		{granted: "users:*", required: "users:read", want: true},
+		{granted: "users:*", required: "users:profile:write", want: true},
+		{granted: "users:*", required: "users", want: false},
+		{granted: "users:*", required: "usersx:read", want: false},
+		{granted: "users:profile", required: "users:profile:write", want: true},
+		{granted: "users:profile", required: "users:profiles:write", want: false},
+		{granted: "users:profile:write", required: "users:profile", want: false},
+		{granted: "users", required: "users:read", want: true},
+		{granted: "users", required: "usersx:read", want: false},
+		{granted: "", required: "users:read", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := common.ScopeGrants(tt.granted, tt.required); got != tt.want {
+			t.Errorf("ScopeGrants(%q, %q) = %v, want %v", tt.granted, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestCheckScopes(t *testing.T) {
+	tests := []struct {
+		name     string
+		required []string
+		granted  []string
+		wantErr  bool
+	}{
+		{name: "nothing required", required: nil, granted: nil},
+		{name: "exact scope", required: []string{"users:read"}, granted: []string{"users:read"}},
+		{name: "all scopes", required: []string{"users:read", "users:write"}, granted: []string{"*"}},
+		{name: "scopes under a prefix", required: []string{"users:read", "users:write"}, granted: []string{"users:*"}},
+		{name: "hierarchical scope", required: []string{"users:profile:write"}, granted: []string{"users:profile"}},
+		{name: "each scope by another grant", required: []string{"users:read", "users:write"}, granted: []string{"users:write", "users:read"}},
+		{name: "one scope missing", required: []string{"users:read", "users:write"}, granted: []string{"users:read"}, wantErr: true},
+		{name: "no grants", required: []string{"users:read"}, granted: nil, wantErr: true},
+		{name: "non-matching prefix", required: []string{"usersx:read"}, granted: []string{"users"}, wantErr: true},
+		{name: "non-matching wildcard prefix", required: []string{"usersx:read"}, granted: []string{"users:*"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := common.CheckScopes(tt.required, tt.granted)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("CheckScopes(%q, %q) = %v, want nil", tt.required, tt.granted, err)
+				}
+				return
+			}
+
+			var slugError commonerrors.SlugError
+			if !errors.As(err, &slugError) {
+				t.Fatalf("CheckScopes(%q, %q) = %v, want a slug error", tt.required, tt.granted, err)
+			}
+			if slugError.ErrorType() != commonerrors.ErrorTypeForbidden || slugError.Slug() != "insufficient-scope" {
+				t.Errorf("CheckScopes(%q, %q) = %v (%v), want a forbidden insufficient-scope error", tt.required, tt.granted, slugError.Slug(), slugError.ErrorType())
+			}
+		})
+	}
+}
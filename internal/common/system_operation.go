@@ -0,0 +1,17 @@
+package common
+
+import "context"
+
+type systemOperationContextKey struct{}
+
+// WithSystemOperation marks what is done with the returned context as a
+// system operation, which no user asked for, like scheduled jobs. Writes
+// without an authenticated user are only allowed for system operations.
+func WithSystemOperation(ctx context.Context) context.Context {
+	return context.WithValue(ctx, systemOperationContextKey{}, true)
+}
+
+func IsSystemOperation(ctx context.Context) bool {
+	systemOperation, _ := ctx.Value(systemOperationContextKey{}).(bool)
+	return systemOperation
+}
@@ -0,0 +1,112 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"firebase.google.com/go/auth"
+)
+
+// TokenVerifier checks a bearer token and returns the user it was issued to.
+// Every verifier returns the same User, so handlers don't depend on which
+// one accepted the token.
+type TokenVerifier interface {
+	VerifyToken(ctx context.Context, token string) (User, error)
+}
+
+const (
+	// AuthModeFirebase verifies Firebase ID tokens.
+	AuthModeFirebase = "firebase"
+	// AuthModeJWS verifies tokens signed with the keys of a JWSValidator.
+	AuthModeJWS = "jws"
+)
+
+// FirebaseVerifier verifies Firebase ID tokens.
+type FirebaseVerifier struct {
+	authClient *auth.Client
+	claims     ClaimsDecoder
+}
+
+func NewFirebaseVerifier(authClient *auth.Client, claims ClaimsDecoder) FirebaseVerifier {
+	return FirebaseVerifier{authClient: authClient, claims: claims}
+}
+
+func (v FirebaseVerifier) VerifyToken(ctx context.Context, token string) (User, error) {
+	idToken, err := v.authClient.VerifyIDToken(ctx, token)
+	if err != nil {
+		return User{}, err
+	}
+
+	return v.claims.Decode(idToken.UID, idToken.Claims)
+}
+
+// JWSVerifier verifies tokens with a JWSValidator, like FakeAuthenticator.
+type JWSVerifier struct {
+	validator JWSValidator
+	claims    ClaimsDecoder
+}
+
+func NewJWSVerifier(validator JWSValidator, claims ClaimsDecoder) JWSVerifier {
+	return JWSVerifier{validator: validator, claims: claims}
+}
+
+func (v JWSVerifier) VerifyToken(ctx context.Context, token string) (User, error) {
+	jwtToken, err := v.validator.ValidateJWS(token)
+	if err != nil {
+		return User{}, err
+	}
+
+	claims, err := jwtToken.AsMap(ctx)
+	if err != nil {
+		return User{}, fmt.Errorf("reading claims: %w", err)
+	}
+
+	return v.claims.Decode(jwtToken.Subject(), claims)
+}
+
+// ChainVerifier tries its verifiers in order, the first one accepting the
+// token wins.
+type ChainVerifier []TokenVerifier
+
+func (c ChainVerifier) VerifyToken(ctx context.Context, token string) (User, error) {
+	errs := make([]error, 0, len(c))
+	for _, verifier := range c {
+		user, err := verifier.VerifyToken(ctx, token)
+		if err == nil {
+			return user, nil
+		}
+		errs = append(errs, err)
+	}
+
+	return User{}, errors.Join(errs...)
+}
+
+// NewTokenVerifier builds the verifier of a comma-separated list of auth
+// modes, like "firebase", "jws" or "jws,firebase". Several modes are tried in
+// the order of the list. newVerifier builds the verifier of every mode, so
+// clients of modes which aren't used are never created.
+func NewTokenVerifier(modes string, newVerifier func(mode string) (TokenVerifier, error)) (TokenVerifier, error) {
+	var chain ChainVerifier
+	for _, mode := range strings.Split(modes, ",") {
+		mode = strings.TrimSpace(mode)
+		switch mode {
+		case AuthModeFirebase, AuthModeJWS:
+		default:
+			return nil, fmt.Errorf("unknown auth mode %q", mode)
+		}
+
+		verifier, err := newVerifier(mode)
+		if err != nil {
+			return nil, fmt.Errorf("creating %s verifier: %w", mode, err)
+		}
+		chain = append(chain, verifier)
+	}
+
+	if len(chain) == 1 {
+		return chain[0], nil
+	}
+
+	return chain, nil
+}
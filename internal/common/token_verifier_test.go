@@ -0,0 +1,187 @@
+package common_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/shotokan/firebase-training/internal/common"
+	commonerrors "github.com/shotokan/firebase-training/internal/common/errors"
+)
+
+// stubVerifier accepts every token as its user, or fails with its err, and
+// records its name in calls.
+type stubVerifier struct {
+	name  string
+	user  common.User
+	err   error
+	calls *[]string
+}
+
+func (v stubVerifier) VerifyToken(ctx context.Context, token string) (common.User, error) {
+	if v.calls != nil {
+		*v.calls = append(*v.calls, v.name)
+	}
+	if v.err != nil {
+		return common.User{}, v.err
+	}
+
+	return v.user, nil
+}
+
+func TestNewTokenVerifier(t *testing.T) {
+	tests := []struct {
+		name      string
+		modes     string
+		wantModes []string
+		wantErr   bool
+	}{
+		{name: "firebase", modes: "firebase", wantModes: []string{"firebase"}},
+		{name: "jws", modes: "jws", wantModes: []string{"jws"}},
+		{name: "both in order", modes: "jws,firebase", wantModes: []string{"jws", "firebase"}},
+		{name: "both in the other order", modes: "firebase,jws", wantModes: []string{"firebase", "jws"}},
+		{name: "spaces around modes", modes: " jws , firebase ", wantModes: []string{"jws", "firebase"}},
+
+		{name: "unknown mode", modes: "oauth", wantErr: true},
+		{name: "unknown mode in a list", modes: "jws,oauth", wantErr: true},
+		{name: "empty modes", modes: "", wantErr: true},
+		{name: "empty mode in a list", modes: "jws,", wantErr: true},
+		{name: "mode in another case", modes: "JWS", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created []string
+			verifier, err := common.NewTokenVerifier(tt.modes, func(mode string) (common.TokenVerifier, error) {
+				created = append(created, mode)
+				return stubVerifier{name: mode}, nil
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("NewTokenVerifier(%q) = nil error, want an error", tt.modes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewTokenVerifier(%q) = %v, want nil", tt.modes, err)
+			}
+
+			if !reflect.DeepEqual(created, tt.wantModes) {
+				t.Errorf("created verifiers %v, want %v", created, tt.wantModes)
+			}
+			if len(tt.wantModes) == 1 {
+				if !reflect.DeepEqual(verifier, stubVerifier{name: tt.wantModes[0]}) {
+					t.Errorf("got %#v, want the %s verifier itself", verifier, tt.wantModes[0])
+				}
+				return
+			}
+
+			chain, ok := verifier.(common.ChainVerifier)
+			if !ok {
+				t.Fatalf("got %T, want a ChainVerifier", verifier)
+			}
+			var chainModes []string
+			for _, v := range chain {
+				chainModes = append(chainModes, v.(stubVerifier).name)
+			}
+			if !reflect.DeepEqual(chainModes, tt.wantModes) {
+				t.Errorf("chain of %v, want %v", chainModes, tt.wantModes)
+			}
+		})
+	}
+}
+
+func TestNewTokenVerifierCreationError(t *testing.T) {
+	errNoCredentials := errors.New("no credentials")
+	_, err := common.NewTokenVerifier("jws,firebase", func(mode string) (common.TokenVerifier, error) {
+		if mode == common.AuthModeFirebase {
+			return nil, errNoCredentials
+		}
+		return stubVerifier{name: mode}, nil
+	})
+
+	if !errors.Is(err, errNoCredentials) {
+		t.Errorf("NewTokenVerifier() = %v, want the error of the firebase verifier", err)
+	}
+}
+
+func TestChainVerifierOrder(t *testing.T) {
+	amy := common.User{UUID: "amy"}
+	bo := common.User{UUID: "bo"}
+	errRejected := errors.New("rejected")
+
+	tests := []struct {
+		name      string
+		chain     func(calls *[]string) common.ChainVerifier
+		want      common.User
+		wantCalls []string
+	}{
+		{
+			name: "first verifier accepts",
+			chain: func(calls *[]string) common.ChainVerifier {
+				return common.ChainVerifier{
+					stubVerifier{name: "first", user: amy, calls: calls},
+					stubVerifier{name: "second", user: bo, calls: calls},
+				}
+			},
+			want:      amy,
+			wantCalls: []string{"first"},
+		},
+		{
+			name: "second verifier accepts",
+			chain: func(calls *[]string) common.ChainVerifier {
+				return common.ChainVerifier{
+					stubVerifier{name: "first", err: errRejected, calls: calls},
+					stubVerifier{name: "second", user: bo, calls: calls},
+					stubVerifier{name: "third", user: amy, calls: calls},
+				}
+			},
+			want:      bo,
+			wantCalls: []string{"first", "second"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			user, err := tt.chain(&calls).VerifyToken(context.Background(), "token")
+			if err != nil {
+				t.Fatalf("VerifyToken() = %v, want nil", err)
+			}
+			if !reflect.DeepEqual(user, tt.want) {
+				t.Errorf("VerifyToken() = %+v, want %+v", user, tt.want)
+			}
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("verifiers called %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestChainVerifierJoinsErrors(t *testing.T) {
+	errRejected := errors.New("rejected")
+	claimsError := commonerrors.NewAuthorizationError("no subject", "missing-token-claim")
+
+	var calls []string
+	chain := common.ChainVerifier{
+		stubVerifier{name: "first", err: errRejected, calls: &calls},
+		stubVerifier{name: "second", err: claimsError, calls: &calls},
+	}
+
+	_, err := chain.VerifyToken(context.Background(), "token")
+
+	if !reflect.DeepEqual(calls, []string{"first", "second"}) {
+		t.Errorf("verifiers called %v, want both", calls)
+	}
+	if !errors.Is(err, errRejected) {
+		t.Errorf("VerifyToken() = %v, want the error of the first verifier", err)
+	}
+	var slugError commonerrors.SlugError
+	if !errors.As(err, &slugError) {
+		t.Fatalf("VerifyToken() = %v, want the slug error of the second verifier", err)
+	}
+	if slugError.Slug() != "missing-token-claim" {
+		t.Errorf("got slug %q, want missing-token-claim", slugError.Slug())
+	}
+}
@@ -0,0 +1,34 @@
+package adapters
+
+import (
+	"context"
+
+	"github.com/shotokan/firebase-training/internal/common"
+)
+
+// systemActor is recorded as the author of writes made by system operations.
+const systemActor = "system"
+
+// auditActor returns who is writing users with ctx: the ID of the
+// authenticated user, or systemActor for system operations. Other writes fail
+// with common.NoUserInContextError.
+func auditActor(ctx context.Context) (string, error) {
+	user, err := common.UserFromCtx(ctx)
+	if err == nil {
+		return user.UUID, nil
+	}
+	if common.IsSystemOperation(ctx) {
+		return systemActor, nil
+	}
+
+	return "", err
+}
+
+// keepAuditFields copies the audit metadata of the stored user to its update,
+// so it is only ever changed by the repository.
+func keepAuditFields(stored User, updated *User) {
+	updated.CreatedAt = stored.CreatedAt
+	updated.CreatedBy = stored.CreatedBy
+	updated.UpdatedAt = stored.UpdatedAt
+	updated.UpdatedBy = stored.UpdatedBy
+}
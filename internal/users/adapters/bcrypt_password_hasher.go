@@ -0,0 +1,30 @@
+package adapters
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BcryptPasswordHasher hashes passwords with bcrypt. Cost is the log2 of the
+// number of key expansion rounds, so every increment doubles the hashing time.
+type BcryptPasswordHasher struct {
+	cost int
+}
+
+func NewBcryptPasswordHasher(cost int) (*BcryptPasswordHasher, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost %d out of range [%d, %d]", cost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	return &BcryptPasswordHasher{cost: cost}, nil
+}
+
+func (h BcryptPasswordHasher) HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", fmt.Errorf("hashing password: %w", err)
+	}
+
+	return string(hash), nil
+}
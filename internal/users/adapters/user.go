@@ -1,8 +1,97 @@
 package adapters
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shotokan/firebase-training/internal/users/models"
+)
+
 type User struct {
-	ID       string `firestore:"id"`
-	Name     string `firestore:"name,omitempty"`
-	Email    string `firestore:"email"`
-	Password string `firestore:"password"`
+	// SchemaVersion is the version of the shape of the document, older
+	// documents are upgraded by the migrations of user_migrations.go.
+	SchemaVersion int `firestore:"schemaVersion"`
+
+	ID    string `firestore:"id"`
+	Name  string `firestore:"name,omitempty"`
+	Email string `firestore:"email"`
+	// NormalizedEmail is derived from Email, it backs case-insensitive
+	// prefix queries.
+	NormalizedEmail string `firestore:"normalizedEmail"`
+	PasswordHash    string `firestore:"passwordHash"`
+	Role            string `firestore:"role"`
+	AuthSubject     string `firestore:"authSubject,omitempty"`
+	// Profile fields are left out while not set.
+	Phone     string `firestore:"phone,omitempty"`
+	Locale    string `firestore:"locale,omitempty"`
+	Timezone  string `firestore:"timezone,omitempty"`
+	AvatarURL string `firestore:"avatarUrl,omitempty"`
+	Bio       string `firestore:"bio,omitempty"`
+	// CreatedAt and UpdatedAt are written as server timestamps while zero.
+	CreatedAt time.Time `firestore:"createdAt,serverTimestamp"`
+	UpdatedAt time.Time `firestore:"updatedAt,serverTimestamp"`
+	CreatedBy string    `firestore:"createdBy"`
+	UpdatedBy string    `firestore:"updatedBy"`
+	// DeletedAt is stored as null for users which are not deleted, so they
+	// can be queried by equality.
+	DeletedAt *time.Time `firestore:"deletedAt"`
+}
+
+// UserEmail reserves a normalized email for a single user, which is how
+// uniqueness of emails is enforced.
+type UserEmail struct {
+	Email  string `firestore:"email"`
+	UserID string `firestore:"userId"`
+}
+
+func marshalUser(user models.User) User {
+	return User{
+		SchemaVersion:   currentUserSchemaVersion(),
+		ID:              user.ID.String(),
+		Name:            user.Name,
+		Email:           user.Email,
+		NormalizedEmail: models.NormalizedEmail(user.Email),
+		PasswordHash:    user.PasswordHash,
+		Role:            user.Role,
+		AuthSubject:     user.AuthSubject,
+		Phone:           user.Profile.Phone,
+		Locale:          user.Profile.Locale,
+		Timezone:        user.Profile.Timezone,
+		AvatarURL:       user.Profile.AvatarURL,
+		Bio:             user.Profile.Bio,
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
+		CreatedBy:       user.CreatedBy,
+		UpdatedBy:       user.UpdatedBy,
+		DeletedAt:       user.DeletedAt,
+	}
+}
+
+func unmarshalUser(userDto User) (models.User, error) {
+	id, err := uuid.Parse(userDto.ID)
+	if err != nil {
+		return models.User{}, fmt.Errorf("parsing id of user %q: %w", userDto.ID, err)
+	}
+
+	return models.User{
+		ID:           id,
+		Name:         userDto.Name,
+		Email:        userDto.Email,
+		PasswordHash: userDto.PasswordHash,
+		Role:         userDto.Role,
+		AuthSubject:  userDto.AuthSubject,
+		Profile: models.UserProfile{
+			Phone:     userDto.Phone,
+			Locale:    userDto.Locale,
+			Timezone:  userDto.Timezone,
+			AvatarURL: userDto.AvatarURL,
+			Bio:       userDto.Bio,
+		},
+		CreatedAt: userDto.CreatedAt,
+		UpdatedAt: userDto.UpdatedAt,
+		CreatedBy: userDto.CreatedBy,
+		UpdatedBy: userDto.UpdatedBy,
+		DeletedAt: userDto.DeletedAt,
+	}, nil
 }
@@ -0,0 +1,235 @@
+package adapters
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"github.com/shotokan/firebase-training/internal/users/models"
+)
+
+// PasswordHasher hashes the plaintext passwords of the first users, as their
+// upgrade is written.
+type PasswordHasher interface {
+	HashPassword(password string) (string, error)
+}
+
+// userMigration upgrades the data of a user document from the previous schema
+// version to Version. Migrations work on raw document data, as old documents
+// may not fit the current User anymore.
+type userMigration struct {
+	Version     int
+	Description string
+	Migrate     func(data map[string]interface{}) error
+}
+
+// userMigrations are applied in order, userMigrations[i] upgrades documents
+// to version i+1. Documents without schemaVersion are version 0.
+var userMigrations []userMigration
+
+// registerUserMigration adds the migration to the next schema version.
+func registerUserMigration(version int, description string, migrate func(data map[string]interface{}) error) {
+	if version != len(userMigrations)+1 {
+		panic(fmt.Sprintf("user migration to version %d registered after version %d", version, len(userMigrations)))
+	}
+
+	userMigrations = append(userMigrations, userMigration{
+		Version:     version,
+		Description: description,
+		Migrate:     migrate,
+	})
+}
+
+func init() {
+	registerUserMigration(1, "fill fields missing from the first users", migrateFirstUsers)
+}
+
+// currentUserSchemaVersion is the schema version of the User documents
+// written by this code.
+func currentUserSchemaVersion() int {
+	return len(userMigrations)
+}
+
+// migrateFirstUsers upgrades the documents written before schema versions,
+// which had an id, a name, an email and a plaintext password only. The
+// password is left to hashPlaintextPassword, hashing is too slow for every
+// read.
+func migrateFirstUsers(data map[string]interface{}) error {
+	if email, ok := data["email"].(string); ok {
+		if _, normalized := data["normalizedEmail"]; !normalized {
+			data["normalizedEmail"] = models.NormalizedEmail(email)
+		}
+	}
+	if _, ok := data["role"]; !ok {
+		data["role"] = models.RoleUser
+	}
+	// Queries for users which aren't deleted match null, not missing fields.
+	if _, ok := data["deletedAt"]; !ok {
+		data["deletedAt"] = nil
+	}
+	// The creation time wasn't recorded, the time of the migration is the
+	// closest we have.
+	if _, ok := data["createdAt"]; !ok {
+		data["createdAt"] = firestore.ServerTimestamp
+	}
+
+	return nil
+}
+
+// migrateUserData upgrades data to the current schema version, in place. It
+// reports whether data had an older version. Documents with a newer version,
+// written by newer code during a rollout, are left untouched.
+func migrateUserData(data map[string]interface{}) (bool, error) {
+	version := 0
+	if v, ok := data["schemaVersion"].(int64); ok {
+		version = int(v)
+	}
+	if version >= currentUserSchemaVersion() {
+		return false, nil
+	}
+
+	for _, migration := range userMigrations[version:] {
+		if err := migration.Migrate(data); err != nil {
+			return false, fmt.Errorf("migrating user %v to schema version %d: %w", data["id"], migration.Version, err)
+		}
+		data["schemaVersion"] = int64(migration.Version)
+	}
+
+	return true, nil
+}
+
+// hashPlaintextPassword replaces the plaintext password of the first users
+// with its hash.
+func hashPlaintextPassword(data map[string]interface{}, hasher PasswordHasher) error {
+	rawPassword, ok := data["password"]
+	if !ok {
+		return nil
+	}
+
+	if password, _ := rawPassword.(string); password != "" {
+		if _, hashed := data["passwordHash"]; !hashed {
+			hash, err := hasher.HashPassword(password)
+			if err != nil {
+				return fmt.Errorf("hashing password: %w", err)
+			}
+			data["passwordHash"] = hash
+		}
+	}
+	delete(data, "password")
+
+	return nil
+}
+
+// decodeUserDoc reads a user document, upgrading it first when it has an
+// older schema version. The upgrade is only done in memory and leaves
+// plaintext passwords out, so reads stay cheap.
+func decodeUserDoc(doc *firestore.DocumentSnapshot) (User, error) {
+	userDto, _, err := decodeUserDocWith(doc, nil)
+	return userDto, err
+}
+
+// decodeUserDocUpgrade also returns the updates writing the upgrade, with
+// plaintext passwords hashed by hasher.
+func decodeUserDocUpgrade(doc *firestore.DocumentSnapshot, hasher PasswordHasher) (User, []firestore.Update, error) {
+	return decodeUserDocWith(doc, hasher)
+}
+
+// decodeUserDocWith only returns the upgrade updates with a hasher, without
+// one the upgrade still has the plaintext password.
+func decodeUserDocWith(doc *firestore.DocumentSnapshot, hasher PasswordHasher) (User, []firestore.Update, error) {
+	data := doc.Data()
+	migrated, err := migrateUserData(data)
+	if err != nil {
+		return User{}, nil, err
+	}
+
+	if !migrated {
+		userDto := User{}
+		err := doc.DataTo(&userDto)
+		return userDto, nil, err
+	}
+
+	if hasher != nil {
+		if err := hashPlaintextPassword(data, hasher); err != nil {
+			return User{}, nil, fmt.Errorf("upgrading user %s: %w", doc.Ref.ID, err)
+		}
+	}
+
+	userDto, err := userFromData(data)
+	if err != nil {
+		return User{}, nil, fmt.Errorf("decoding migrated user %s: %w", doc.Ref.ID, err)
+	}
+	if hasher == nil {
+		return userDto, nil, nil
+	}
+
+	return userDto, migrationUpdates(doc.Data(), data), nil
+}
+
+// userFromData decodes migrated document data, which can't go through
+// DocumentSnapshot.DataTo anymore. Missing fields and server timestamps not
+// written yet are left zero.
+func userFromData(data map[string]interface{}) (User, error) {
+	userDto := User{}
+
+	userValue := reflect.ValueOf(&userDto).Elem()
+	userType := userValue.Type()
+
+	for i := 0; i < userType.NumField(); i++ {
+		field := strings.Split(userType.Field(i).Tag.Get("firestore"), ",")[0]
+		if field == "" || field == "-" {
+			continue
+		}
+
+		value, ok := data[field]
+		if !ok || value == nil || value == firestore.ServerTimestamp {
+			continue
+		}
+
+		target := userValue.Field(i)
+		if target.Kind() == reflect.Pointer {
+			target.Set(reflect.New(target.Type().Elem()))
+			target = target.Elem()
+		}
+
+		if err := setDecodedValue(target, reflect.ValueOf(value)); err != nil {
+			return User{}, fmt.Errorf("field %s: %w", field, err)
+		}
+	}
+
+	return userDto, nil
+}
+
+func setDecodedValue(target reflect.Value, value reflect.Value) error {
+	switch {
+	case value.Type().AssignableTo(target.Type()):
+		target.Set(value)
+	case value.CanInt() && target.CanInt():
+		target.SetInt(value.Int())
+	default:
+		return fmt.Errorf("can't decode %s into %s", value.Type(), target.Type())
+	}
+
+	return nil
+}
+
+// migrationUpdates are the updates writing the upgrade of stored data to
+// migrated data, deleting the fields the migrations removed.
+func migrationUpdates(stored, migrated map[string]interface{}) []firestore.Update {
+	var updates []firestore.Update
+
+	for field, value := range migrated {
+		if storedValue, ok := stored[field]; ok && reflect.DeepEqual(storedValue, value) {
+			continue
+		}
+		updates = append(updates, firestore.Update{Path: field, Value: value})
+	}
+	for field := range stored {
+		if _, ok := migrated[field]; !ok {
+			updates = append(updates, firestore.Update{Path: field, Value: firestore.Delete})
+		}
+	}
+
+	return updates
+}
@@ -0,0 +1,90 @@
+package adapters
+
+import (
+	"reflect"
+
+	"github.com/shotokan/firebase-training/internal/users/models"
+)
+
+// userIndex is a composite index of the users collection, made of equality
+// filters followed by an order, in both directions.
+type userIndex struct {
+	equalities []string
+	orderBy    models.UserSortField
+}
+
+// declaredUserIndexes must be kept in sync with firestore.indexes.json.
+var declaredUserIndexes = []userIndex{
+	{equalities: []string{"deletedAt"}, orderBy: models.UserSortByName},
+	{equalities: []string{"deletedAt"}, orderBy: models.UserSortByEmail},
+	{equalities: []string{"deletedAt"}, orderBy: models.UserSortByCreatedAt},
+	{equalities: []string{"role"}, orderBy: models.UserSortByName},
+	{equalities: []string{"role"}, orderBy: models.UserSortByCreatedAt},
+	{equalities: []string{"role", "deletedAt"}, orderBy: models.UserSortByName},
+	{equalities: []string{"role", "deletedAt"}, orderBy: models.UserSortByCreatedAt},
+}
+
+// resolveUserSort returns the effective sort of the query, or an error when
+// Firestore can't run it with the declared indexes. Every adapter checks
+// queries with it, so all of them accept exactly the same queries.
+func resolveUserSort(query models.UserQuery) (models.UserSort, error) {
+	sort := query.Sort
+
+	// Firestore allows range filters on a single field, which must also be
+	// the first ordered field.
+	var rangeField models.UserSortField
+	if query.Filter.EmailPrefix != "" {
+		rangeField = models.UserSortByEmail
+	}
+	if query.Filter.CreatedFrom != nil || query.Filter.CreatedTo != nil {
+		if rangeField != "" {
+			return models.UserSort{}, models.ErrUnsupportedFilterCombination
+		}
+		rangeField = models.UserSortByCreatedAt
+	}
+
+	if rangeField != "" {
+		if sort.Field == "" {
+			sort.Field = rangeField
+		} else if sort.Field != rangeField {
+			return models.UserSort{}, models.ErrUnsupportedFilterCombination
+		}
+	}
+
+	if sort.Field == "" {
+		sort.Field = models.UserSortByID
+	}
+
+	// Equality filters ordered by document ID are served by merging single
+	// field indexes, any other order needs a composite index.
+	equalities := userQueryEqualities(query.Filter)
+	if len(equalities) > 0 && sort.Field != models.UserSortByID && !isUserIndexDeclared(equalities, sort.Field) {
+		return models.UserSort{}, models.ErrMissingCompositeIndex
+	}
+
+	return sort, nil
+}
+
+// userQueryEqualities lists the fields filtered by equality, in the order of
+// the declared indexes.
+func userQueryEqualities(filter models.UserFilter) []string {
+	var equalities []string
+	if filter.Role != "" {
+		equalities = append(equalities, "role")
+	}
+	if !filter.IncludeDeleted {
+		equalities = append(equalities, "deletedAt")
+	}
+
+	return equalities
+}
+
+func isUserIndexDeclared(equalities []string, orderBy models.UserSortField) bool {
+	for _, index := range declaredUserIndexes {
+		if reflect.DeepEqual(index.equalities, equalities) && index.orderBy == orderBy {
+			return true
+		}
+	}
+
+	return false
+}
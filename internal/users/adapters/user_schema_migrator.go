@@ -0,0 +1,310 @@
+package adapters
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/shotokan/firebase-training/internal/users/models"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const defaultMigrationBatchSize = 200
+
+// UserSchemaMigrationOptions tune a run of UserSchemaMigrator.Migrate.
+type UserSchemaMigrationOptions struct {
+	// DryRun counts the users to migrate without writing anything, the
+	// checkpoint included. Dry runs always scan all users.
+	DryRun bool
+	// Restart ignores the checkpoint of previous runs.
+	Restart bool
+	// BatchSize is the number of users read at once.
+	BatchSize int
+	// Progress is called after every batch.
+	Progress func(progress UserSchemaMigrationProgress)
+}
+
+// UserSchemaMigrationProgress is also the checkpoint stored between batches,
+// a new run resumes after LastUserID.
+type UserSchemaMigrationProgress struct {
+	TargetVersion int    `firestore:"targetVersion"`
+	LastUserID    string `firestore:"lastUserId"`
+	Scanned       int    `firestore:"scanned"`
+	Migrated      int    `firestore:"migrated"`
+	// Skipped users were written while they were migrated, the write upgraded
+	// them already.
+	Skipped int `firestore:"skipped"`
+	// EmailsReserved counts the users stored before emails were reserved,
+	// whose email is reserved now. EmailConflicts counts the users whose
+	// email is reserved by another user, which are left to be fixed by hand.
+	EmailsReserved int `firestore:"emailsReserved"`
+	EmailConflicts int `firestore:"emailConflicts"`
+	// ReservesEmails is false in the checkpoints of runs which didn't reserve
+	// emails yet, those runs are started over.
+	ReservesEmails bool       `firestore:"reservesEmails"`
+	StartedAt      time.Time  `firestore:"startedAt"`
+	UpdatedAt      time.Time  `firestore:"updatedAt"`
+	DoneAt         *time.Time `firestore:"doneAt"`
+}
+
+// UserSchemaMigrator upgrades all user documents to the current schema
+// version, so the lazy upgrade on read isn't needed anymore and queries match
+// the current shape of the documents. It also reserves the emails of users
+// stored before emails were reserved, so they stay unique.
+type UserSchemaMigrator struct {
+	firestoreClient *firestore.Client
+	passwordHasher  PasswordHasher
+}
+
+func NewUserSchemaMigrator(firestoreClient *firestore.Client, passwordHasher PasswordHasher) *UserSchemaMigrator {
+	return &UserSchemaMigrator{
+		firestoreClient: firestoreClient,
+		passwordHasher:  passwordHasher,
+	}
+}
+
+// Migrate scans users in ID order and writes the upgrade of every document
+// with an older schema version. It resumes from the checkpoint of an earlier
+// run with the same target version, unless opts.Restart is set.
+func (m UserSchemaMigrator) Migrate(ctx context.Context, opts UserSchemaMigrationOptions) (UserSchemaMigrationProgress, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultMigrationBatchSize
+	}
+
+	progress, err := m.startProgress(ctx, opts)
+	if err != nil {
+		return progress, err
+	}
+	if progress.DoneAt != nil {
+		return progress, nil
+	}
+
+	for {
+		q := m.firestoreClient.Collection("users").OrderBy(firestore.DocumentID, firestore.Asc).Limit(opts.BatchSize)
+		if progress.LastUserID != "" {
+			q = q.StartAfter(progress.LastUserID)
+		}
+
+		docs, err := q.Documents(ctx).GetAll()
+		if err != nil {
+			return progress, err
+		}
+
+		if len(docs) > 0 {
+			migrated, skipped, err := m.migrateBatch(ctx, docs, opts.DryRun)
+			if err != nil {
+				return progress, err
+			}
+
+			reserved, conflicts, err := m.reserveEmails(ctx, docs, opts.DryRun)
+			if err != nil {
+				return progress, err
+			}
+
+			progress.Scanned += len(docs)
+			progress.Migrated += migrated
+			progress.Skipped += skipped
+			progress.EmailsReserved += reserved
+			progress.EmailConflicts += conflicts
+			progress.LastUserID = docs[len(docs)-1].Ref.ID
+		}
+
+		progress.UpdatedAt = time.Now().UTC()
+		if len(docs) < opts.BatchSize {
+			progress.DoneAt = &progress.UpdatedAt
+		}
+
+		if !opts.DryRun {
+			if _, err := m.checkpointDoc().Set(ctx, progress); err != nil {
+				return progress, err
+			}
+		}
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+
+		if progress.DoneAt != nil {
+			return progress, nil
+		}
+	}
+}
+
+func (m UserSchemaMigrator) startProgress(ctx context.Context, opts UserSchemaMigrationOptions) (UserSchemaMigrationProgress, error) {
+	fresh := UserSchemaMigrationProgress{
+		TargetVersion:  currentUserSchemaVersion(),
+		ReservesEmails: true,
+		StartedAt:      time.Now().UTC(),
+	}
+	if opts.DryRun || opts.Restart {
+		return fresh, nil
+	}
+
+	doc, err := m.checkpointDoc().Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return fresh, nil
+	}
+	if err != nil {
+		return fresh, err
+	}
+
+	checkpoint := UserSchemaMigrationProgress{}
+	if err := doc.DataTo(&checkpoint); err != nil {
+		return fresh, err
+	}
+	// A checkpoint of an older target version says nothing about the
+	// migrations added since.
+	if checkpoint.TargetVersion != fresh.TargetVersion || !checkpoint.ReservesEmails {
+		return fresh, nil
+	}
+
+	return checkpoint, nil
+}
+
+// migrateBatch returns how many of the users were migrated, and how many
+// were skipped as they changed meanwhile.
+func (m UserSchemaMigrator) migrateBatch(ctx context.Context, docs []*firestore.DocumentSnapshot, dryRun bool) (int, int, error) {
+	bulkWriter := m.firestoreClient.BulkWriter(ctx)
+	defer bulkWriter.End()
+
+	migrated := 0
+	var jobs []*firestore.BulkWriterJob
+	for _, doc := range docs {
+		_, upgrade, err := decodeUserDocUpgrade(doc, m.passwordHasher)
+		if err != nil {
+			return 0, 0, err
+		}
+		if len(upgrade) == 0 {
+			continue
+		}
+
+		migrated++
+		if dryRun {
+			continue
+		}
+
+		job, err := bulkWriter.Update(doc.Ref, upgrade, firestore.LastUpdateTime(doc.UpdateTime))
+		if err != nil {
+			return 0, 0, err
+		}
+		jobs = append(jobs, job)
+	}
+	bulkWriter.Flush()
+
+	skipped := 0
+	for _, job := range jobs {
+		_, err := job.Results()
+		if status.Code(err) == codes.FailedPrecondition {
+			skipped++
+			continue
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if skipped > 0 {
+		logrus.WithField("skipped", skipped).Info("Users changed while they were migrated")
+	}
+
+	return migrated - skipped, skipped, nil
+}
+
+// reserveEmails reserves the emails of the users which have no reservation.
+// It returns how many were reserved, and how many users have an email
+// reserved by another user. Conflicts are logged and left as they are.
+func (m UserSchemaMigrator) reserveEmails(ctx context.Context, docs []*firestore.DocumentSnapshot, dryRun bool) (int, int, error) {
+	users := make([]User, 0, len(docs))
+	refs := make([]*firestore.DocumentRef, 0, len(docs))
+	for _, doc := range docs {
+		user, err := decodeUserDoc(doc)
+		if err != nil {
+			return 0, 0, err
+		}
+		if user.Email == "" {
+			continue
+		}
+		users = append(users, user)
+		refs = append(refs, userEmailDoc(m.firestoreClient, user.Email))
+	}
+	if len(refs) == 0 {
+		return 0, 0, nil
+	}
+
+	reservations, err := m.firestoreClient.GetAll(ctx, refs)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	bulkWriter := m.firestoreClient.BulkWriter(ctx)
+	defer bulkWriter.End()
+
+	conflicts := 0
+	// owners has the users of the emails reserved by this batch, two users
+	// of the batch may share an email.
+	owners := map[string]string{}
+	var jobs []*firestore.BulkWriterJob
+	var jobUsers []User
+	for i, user := range users {
+		owner, reserved := owners[refs[i].ID]
+		if !reserved && reservations[i].Exists() {
+			reservation := UserEmail{}
+			if err := reservations[i].DataTo(&reservation); err != nil {
+				return 0, 0, err
+			}
+			owner, reserved = reservation.UserID, true
+		}
+		if reserved {
+			if owner != user.ID {
+				conflicts++
+				logEmailConflict(user.ID, owner)
+			}
+			continue
+		}
+
+		owners[refs[i].ID] = user.ID
+		if dryRun {
+			continue
+		}
+		job, err := bulkWriter.Create(refs[i], UserEmail{
+			Email:  models.NormalizedEmail(user.Email),
+			UserID: user.ID,
+		})
+		if err != nil {
+			return 0, 0, err
+		}
+		jobs = append(jobs, job)
+		jobUsers = append(jobUsers, user)
+	}
+	bulkWriter.Flush()
+
+	reserved := len(owners) - len(jobs)
+	for i, job := range jobs {
+		_, err := job.Results()
+		// The email was reserved meanwhile, maybe by another user.
+		if status.Code(err) == codes.AlreadyExists {
+			conflicts++
+			logEmailConflict(jobUsers[i].ID, "")
+			continue
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		reserved++
+	}
+
+	return reserved, conflicts, nil
+}
+
+// logEmailConflict reports a user whose email is reserved by owner, empty
+// when not known. Emails are left out of logs.
+func logEmailConflict(userID string, owner string) {
+	logrus.WithFields(logrus.Fields{
+		"user":  userID,
+		"owner": owner,
+	}).Warn("Email of user is reserved by another user")
+}
+
+func (m UserSchemaMigrator) checkpointDoc() *firestore.DocumentRef {
+	return m.firestoreClient.Collection("schemaMigrations").Doc("users")
+}
@@ -2,40 +2,717 @@ package adapters
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
 
 	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
 	"github.com/shotokan/firebase-training/internal/users/models"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// userSortPaths maps sort fields to the ordered firestore fields. Sorting by
+// ID orders by document ID only.
+var userSortPaths = map[models.UserSortField]string{
+	models.UserSortByName:      "name",
+	models.UserSortByEmail:     "normalizedEmail",
+	models.UserSortByCreatedAt: "createdAt",
+}
+
+// userExportPaths are all the fields of users but the password hash, which
+// never leaves Firestore in exports.
+var userExportPaths = func() []string {
+	var paths []string
+
+	userType := reflect.TypeOf(User{})
+	for i := 0; i < userType.NumField(); i++ {
+		field := strings.Split(userType.Field(i).Tag.Get("firestore"), ",")[0]
+		if field == "" || field == "-" || field == "passwordHash" {
+			continue
+		}
+		paths = append(paths, field)
+	}
+
+	return paths
+}()
+
+// purgeBatchSize is the number of users deleted by every bulk write of
+// PurgeDeletedUsers.
+const purgeBatchSize = 250
+
+// userEmailCollection holds the UserEmail reservations.
+const userEmailCollection = "user_emails"
+
 type UserRepository struct {
 	firestoreClient *firestore.Client
+	// passwordHasher hashes the plaintext passwords of the first users as
+	// they are upgraded by writes.
+	passwordHasher PasswordHasher
 }
 
-func NewUserFirestoreRepository(firestoreClient *firestore.Client) *UserRepository {
+func NewUserFirestoreRepository(firestoreClient *firestore.Client, passwordHasher PasswordHasher) *UserRepository {
 	return &UserRepository{
 		firestoreClient: firestoreClient,
+		passwordHasher:  passwordHasher,
 	}
 }
 
-func (repo UserRepository) AddUser(ctx context.Context, user models.User) error {
+// AddUser stores a new user, stamped with server timestamps and the acting
+// principal, and returns it as stored.
+func (repo UserRepository) AddUser(ctx context.Context, user models.User) (models.User, error) {
+	actor, err := auditActor(ctx)
+	if err != nil {
+		return models.User{}, err
+	}
+
 	collection := repo.userCollection()
 
-	userDto := repo.marshalTraining(user)
+	userDto := marshalUser(user)
+	keepAuditFields(User{CreatedBy: actor, UpdatedBy: actor}, &userDto)
+
+	err = repo.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := repo.checkEmailAvailable(tx, userDto.Email, userDto.ID); err != nil {
+			return err
+		}
+
+		if err := tx.Create(collection.Doc(userDto.ID), userDto); err != nil {
+			return err
+		}
+
+		return repo.reserveEmail(tx, userDto.Email, userDto.ID)
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+
+	// Server timestamps are only known once written.
+	return repo.GetUser(ctx, user.ID)
+}
+
+// AddUsers stores many new users with a BulkWriter, outside of transactions.
+// Emails are reserved first, and users are only created with an email of their
+// own. It returns the error of every user, nil for the users created.
+func (repo UserRepository) AddUsers(ctx context.Context, users []models.User) ([]error, error) {
+	actor, err := auditActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, len(users))
+	userDtos := make([]User, len(users))
+	batchEmails := map[string]bool{}
+	for i, user := range users {
+		userDtos[i] = marshalUser(user)
+		keepAuditFields(User{CreatedBy: actor, UpdatedBy: actor}, &userDtos[i])
+
+		if batchEmails[userDtos[i].NormalizedEmail] {
+			errs[i] = models.ErrEmailAlreadyExists
+		}
+		batchEmails[userDtos[i].NormalizedEmail] = true
+	}
+
+	bulkWriter := repo.firestoreClient.BulkWriter(ctx)
+	defer bulkWriter.End()
+
+	emailJobs := make([]*firestore.BulkWriterJob, len(users))
+	for i, userDto := range userDtos {
+		if errs[i] != nil {
+			continue
+		}
+		job, err := bulkWriter.Create(repo.userEmailDoc(userDto.Email), UserEmail{
+			Email:  userDto.NormalizedEmail,
+			UserID: userDto.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		emailJobs[i] = job
+	}
+	bulkWriter.Flush()
+
+	userJobs := make([]*firestore.BulkWriterJob, len(users))
+	for i, job := range emailJobs {
+		if job == nil {
+			continue
+		}
+		if _, err := job.Results(); err != nil {
+			errs[i] = err
+			if status.Code(err) == codes.AlreadyExists {
+				errs[i] = models.ErrEmailAlreadyExists
+			}
+			continue
+		}
+
+		userJob, err := bulkWriter.Create(repo.userCollection().Doc(userDtos[i].ID), userDtos[i])
+		if err != nil {
+			return nil, err
+		}
+		userJobs[i] = userJob
+	}
+	bulkWriter.Flush()
+
+	for i, job := range userJobs {
+		if job == nil {
+			continue
+		}
+		if _, err := job.Results(); err != nil {
+			errs[i] = err
+			// The user wasn't created, its email is free again.
+			if _, err := bulkWriter.Delete(repo.userEmailDoc(userDtos[i].Email)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return errs, nil
+}
+
+func (repo UserRepository) GetUser(ctx context.Context, userID uuid.UUID) (models.User, error) {
+	doc, err := repo.userCollection().Doc(userID.String()).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return models.User{}, models.ErrUserNotFound
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return repo.unmarshalUserDoc(doc)
+}
+
+// GetUsersByID reads all users with a single GetAll.
+func (repo UserRepository) GetUsersByID(ctx context.Context, userIDs []uuid.UUID) ([]*models.User, error) {
+	docRefs := make([]*firestore.DocumentRef, len(userIDs))
+	for i, userID := range userIDs {
+		docRefs[i] = repo.userCollection().Doc(userID.String())
+	}
+
+	// Snapshots come in the order of docRefs, missing users don't exist.
+	docs, err := repo.firestoreClient.GetAll(ctx, docRefs)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]*models.User, len(docs))
+	for i, doc := range docs {
+		if !doc.Exists() {
+			continue
+		}
+
+		user, err := repo.unmarshalUserDoc(doc)
+		if err != nil {
+			return nil, err
+		}
+		users[i] = &user
+	}
+
+	return users, nil
+}
+
+// ListUsers returns a page of users matching the query. Users with equal
+// values of the sort field are ordered by document ID.
+func (repo UserRepository) ListUsers(ctx context.Context, query models.UserQuery) (models.UserPage, error) {
+	sort, err := resolveUserSort(query)
+	if err != nil {
+		return models.UserPage{}, err
+	}
+
+	q := repo.userCollection().Query
+
+	filter := query.Filter
+	if filter.Role != "" {
+		q = q.Where("role", "==", filter.Role)
+	}
+	// Equality filters skip documents without the field, users written
+	// before soft deletion are only listed once cmd/migrate gave them a
+	// null deletedAt.
+	if !filter.IncludeDeleted {
+		q = q.Where("deletedAt", "==", nil)
+	}
+	if filter.EmailPrefix != "" {
+		prefix := models.NormalizedEmail(filter.EmailPrefix)
+		// \uf8ff is a very high code point, so the range covers all emails
+		// starting with prefix.
+		q = q.Where("normalizedEmail", ">=", prefix).Where("normalizedEmail", "<", prefix+"\uf8ff")
+	}
+	if filter.CreatedFrom != nil {
+		q = q.Where("createdAt", ">=", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		q = q.Where("createdAt", "<", *filter.CreatedTo)
+	}
+
+	direction := firestore.Asc
+	if sort.Descending {
+		direction = firestore.Desc
+	}
+
+	sortPath, hasSortPath := userSortPaths[sort.Field]
+	if hasSortPath {
+		q = q.OrderBy(sortPath, direction)
+	}
+	q = q.OrderBy(firestore.DocumentID, direction)
+
+	if query.After != nil {
+		if hasSortPath {
+			q = q.StartAfter(userCursorValue(*query.After, sort.Field), query.After.ID)
+		} else {
+			q = q.StartAfter(query.After.ID)
+		}
+	}
+
+	// One extra document tells whether there is a next page.
+	docs, err := q.Limit(query.Limit + 1).Documents(ctx).GetAll()
+	if err != nil {
+		return models.UserPage{}, err
+	}
+
+	page := models.UserPage{Users: make([]models.User, 0, query.Limit)}
+	for i, doc := range docs {
+		if i == query.Limit {
+			cursor := models.NewUserCursor(page.Users[i-1])
+			page.Next = &cursor
+			break
+		}
+
+		user, err := repo.unmarshalUserDoc(doc)
+		if err != nil {
+			return models.UserPage{}, err
+		}
+		page.Users = append(page.Users, user)
+	}
+
+	return page, nil
+}
+
+// ExportUsers streams users from a document iterator, so memory use doesn't
+// grow with the number of users. Deleted users are skipped here rather than
+// by the query, which would also skip documents without deletedAt.
+func (repo UserRepository) ExportUsers(ctx context.Context, includeDeleted bool, fn func(user models.User) error) error {
+	q := repo.userCollection().Select(userExportPaths...)
+
+	iter := q.OrderBy(firestore.DocumentID, firestore.Asc).Documents(ctx)
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		user, err := repo.unmarshalUserDoc(doc)
+		if err != nil {
+			return err
+		}
+		if user.IsDeleted() && !includeDeleted {
+			continue
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+}
+
+// WatchUsers listens to the users updated since the position, ordered like
+// positions, so the first snapshot replays the changes missed. Users removed
+// later leave the query, which reports their removal.
+func (repo UserRepository) WatchUsers(
+	ctx context.Context,
+	after *models.UserChangePosition,
+	fn func(change models.UserChange) error,
+) error {
+	since := time.Now().UTC()
+	if after != nil {
+		since = after.Time
+	}
+
+	iter := repo.userCollection().
+		Where("updatedAt", ">=", since).
+		OrderBy("updatedAt", firestore.Asc).
+		OrderBy(firestore.DocumentID, firestore.Asc).
+		Snapshots(ctx)
+	defer iter.Stop()
+
+	for {
+		snapshot, err := iter.Next()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, docChange := range snapshot.Changes {
+			user, err := repo.unmarshalUserDoc(docChange.Doc)
+			if err != nil {
+				return err
+			}
+
+			var change models.UserChange
+			if docChange.Kind == firestore.DocumentRemoved {
+				change = models.NewUserRemoval(user, snapshot.ReadTime)
+			} else {
+				change = models.NewUserChange(user)
+				// Users changed at the position itself were reported before.
+				if after != nil && !change.Position.After(*after) {
+					continue
+				}
+			}
+
+			if err := fn(change); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// UpdateUser loads the user, applies updateFn and writes back only the fields
+// that updateFn changed, so concurrent updates of other fields are preserved.
+// The write fails with models.ErrUserModified unless the user satisfies the
+// precondition.
+func (repo UserRepository) UpdateUser(
+	ctx context.Context,
+	userID uuid.UUID,
+	precondition models.Precondition,
+	updateFn func(ctx context.Context, user *models.User) (*models.User, error),
+) (models.User, error) {
+	actor, err := auditActor(ctx)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	docRef := repo.userCollection().Doc(userID.String())
+
+	err = repo.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if status.Code(err) == codes.NotFound {
+			return models.ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		user, upgrade, err := repo.unmarshalUserDocUpgrade(doc)
+		if err != nil {
+			return err
+		}
+		if err := precondition.Check(user); err != nil {
+			return err
+		}
+
+		before := marshalUser(user)
+
+		updatedUser, err := updateFn(ctx, &user)
+		if err != nil {
+			return err
+		}
+		updatedUser.ID = userID
+
+		after := marshalUser(*updatedUser)
+		keepAuditFields(before, &after)
+
+		emailChanged := models.NormalizedEmail(before.Email) != models.NormalizedEmail(after.Email)
+		if emailChanged {
+			if err := repo.checkEmailAvailable(tx, after.Email, after.ID); err != nil {
+				return err
+			}
+		}
+
+		updates := userUpdates(before, after)
+		if len(updates) > 0 {
+			updates = append(updates,
+				firestore.Update{Path: "updatedAt", Value: firestore.ServerTimestamp},
+				firestore.Update{Path: "updatedBy", Value: actor},
+			)
+		}
+		// Documents with an older schema version are upgraded on their next
+		// write.
+		updates = mergeUpdates(upgrade, updates)
+		if len(updates) == 0 {
+			return nil
+		}
+
+		var preconditions []firestore.Precondition
+		if !precondition.LastUpdateTime.IsZero() {
+			preconditions = append(preconditions, firestore.LastUpdateTime(precondition.LastUpdateTime))
+		}
+		if err := tx.Update(docRef, updates, preconditions...); err != nil {
+			return err
+		}
+
+		if !emailChanged {
+			return nil
+		}
+		if err := tx.Delete(repo.userEmailDoc(before.Email)); err != nil {
+			return err
+		}
+
+		return repo.reserveEmail(tx, after.Email, after.ID)
+	})
+	if status.Code(err) == codes.FailedPrecondition {
+		return models.User{}, models.ErrUserModified
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	// Transactions don't report the update time of their writes.
+	return repo.GetUser(ctx, userID)
+}
+
+func (repo UserRepository) DeleteUser(ctx context.Context, userID uuid.UUID) error {
+	if _, err := auditActor(ctx); err != nil {
+		return err
+	}
+
+	docRef := repo.userCollection().Doc(userID.String())
 
 	return repo.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
-		return tx.Create(collection.Doc(userDto.ID), userDto)
+		doc, err := tx.Get(docRef)
+		if status.Code(err) == codes.NotFound {
+			return models.ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		user, err := repo.unmarshalUserDoc(doc)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Delete(docRef); err != nil {
+			return err
+		}
+
+		return tx.Delete(repo.userEmailDoc(user.Email))
 	})
 }
 
-func (repo UserRepository) marshalTraining(user models.User) User {
-	return User{
-		ID:       user.ID.String(),
-		Name:     user.Name,
-		Email:    user.Email,
-		Password: user.Password,
+// PurgeDeletedUsers hard-deletes users soft-deleted before deletedBefore and
+// releases their emails. It returns how many users were purged. It stops
+// with an error when none of a batch could be purged, the next query would
+// return the same users.
+func (repo UserRepository) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int, error) {
+	if _, err := auditActor(ctx); err != nil {
+		return 0, err
+	}
+
+	purged := 0
+
+	for {
+		docs, err := repo.userCollection().
+			Where("deletedAt", "<", deletedBefore).
+			Limit(purgeBatchSize).
+			Documents(ctx).
+			GetAll()
+		if err != nil {
+			return purged, err
+		}
+
+		batchPurged, err := repo.purgeUserDocs(ctx, docs)
+		purged += batchPurged
+		if err != nil {
+			return purged, err
+		}
+		if len(docs) > 0 && batchPurged == 0 {
+			return purged, fmt.Errorf("none of %d deleted users could be purged", len(docs))
+		}
+
+		if len(docs) < purgeBatchSize {
+			return purged, nil
+		}
 	}
 }
 
+func (repo UserRepository) purgeUserDocs(ctx context.Context, docs []*firestore.DocumentSnapshot) (int, error) {
+	bulkWriter := repo.firestoreClient.BulkWriter(ctx)
+	defer bulkWriter.End()
+
+	jobs := make([]*firestore.BulkWriterJob, len(docs))
+	for i, doc := range docs {
+		// A user restored after the query must not be purged.
+		job, err := bulkWriter.Delete(doc.Ref, firestore.LastUpdateTime(doc.UpdateTime))
+		if err != nil {
+			return 0, err
+		}
+		jobs[i] = job
+	}
+	bulkWriter.Flush()
+
+	purged := 0
+	var emailJobs []*firestore.BulkWriterJob
+	for i, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			logrus.WithError(err).WithField("user_id", docs[i].Ref.ID).Warn("Unable to purge deleted user")
+			continue
+		}
+		purged++
+
+		userDto := User{}
+		if err := docs[i].DataTo(&userDto); err != nil {
+			return purged, err
+		}
+		emailJob, err := bulkWriter.Delete(repo.userEmailDoc(userDto.Email))
+		if err != nil {
+			return purged, err
+		}
+		emailJobs = append(emailJobs, emailJob)
+	}
+	bulkWriter.Flush()
+
+	for _, job := range emailJobs {
+		if _, err := job.Results(); err != nil {
+			return purged, err
+		}
+	}
+
+	return purged, nil
+}
+
+func (repo UserRepository) unmarshalUserDoc(doc *firestore.DocumentSnapshot) (models.User, error) {
+	userDto, err := decodeUserDoc(doc)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return unmarshalUserDto(userDto, doc)
+}
+
+// unmarshalUserDocUpgrade also returns the updates upgrading the document to
+// the current schema version, which are empty for current documents. It is
+// for writes only, upgrades hash plaintext passwords.
+func (repo UserRepository) unmarshalUserDocUpgrade(doc *firestore.DocumentSnapshot) (models.User, []firestore.Update, error) {
+	userDto, upgrade, err := decodeUserDocUpgrade(doc, repo.passwordHasher)
+	if err != nil {
+		return models.User{}, nil, err
+	}
+
+	user, err := unmarshalUserDto(userDto, doc)
+	if err != nil {
+		return models.User{}, nil, err
+	}
+
+	return user, upgrade, nil
+}
+
+func unmarshalUserDto(userDto User, doc *firestore.DocumentSnapshot) (models.User, error) {
+	user, err := unmarshalUser(userDto)
+	if err != nil {
+		return models.User{}, err
+	}
+	user.UpdateTime = doc.UpdateTime
+
+	return user, nil
+}
+
+func userCursorValue(cursor models.UserCursor, field models.UserSortField) interface{} {
+	switch field {
+	case models.UserSortByName:
+		return cursor.Name
+	case models.UserSortByEmail:
+		return cursor.NormalizedEmail
+	case models.UserSortByCreatedAt:
+		return cursor.CreatedAt
+	default:
+		return cursor.ID
+	}
+}
+
+// checkEmailAvailable fails with models.ErrEmailAlreadyExists when the email is
+// reserved by a user other than userID. It must run before any write of tx.
+func (repo UserRepository) checkEmailAvailable(tx *firestore.Transaction, email string, userID string) error {
+	doc, err := tx.Get(repo.userEmailDoc(email))
+	if status.Code(err) == codes.NotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	reservation := UserEmail{}
+	if err := doc.DataTo(&reservation); err != nil {
+		return err
+	}
+
+	if reservation.UserID != userID {
+		return models.ErrEmailAlreadyExists
+	}
+
+	return nil
+}
+
+func (repo UserRepository) reserveEmail(tx *firestore.Transaction, email string, userID string) error {
+	return tx.Set(repo.userEmailDoc(email), UserEmail{
+		Email:  models.NormalizedEmail(email),
+		UserID: userID,
+	})
+}
+
+func (repo UserRepository) userEmailDoc(email string) *firestore.DocumentRef {
+	return userEmailDoc(repo.firestoreClient, email)
+}
+
+// userEmailDoc is keyed by a hash of the normalized email, as emails may
+// contain characters which are not allowed in document IDs.
+func userEmailDoc(client *firestore.Client, email string) *firestore.DocumentRef {
+	sum := sha256.Sum256([]byte(models.NormalizedEmail(email)))
+
+	return client.Collection(userEmailCollection).Doc(hex.EncodeToString(sum[:]))
+}
+
 func (repo UserRepository) userCollection() *firestore.CollectionRef {
 	return repo.firestoreClient.Collection("users")
 }
+
+// mergeUpdates adds updates to base. Updates of the same field replace the
+// ones of base, Firestore rejects a field updated twice.
+func mergeUpdates(base []firestore.Update, updates []firestore.Update) []firestore.Update {
+	updatedFields := map[string]bool{}
+	for _, update := range updates {
+		updatedFields[update.Path] = true
+	}
+
+	merged := make([]firestore.Update, 0, len(base)+len(updates))
+	for _, update := range base {
+		if !updatedFields[update.Path] {
+			merged = append(merged, update)
+		}
+	}
+
+	return append(merged, updates...)
+}
+
+// userUpdates returns a field-level update for every firestore field that
+// differs between before and after.
+func userUpdates(before, after User) []firestore.Update {
+	var updates []firestore.Update
+
+	beforeValue := reflect.ValueOf(before)
+	afterValue := reflect.ValueOf(after)
+	userType := beforeValue.Type()
+
+	for i := 0; i < userType.NumField(); i++ {
+		field := strings.Split(userType.Field(i).Tag.Get("firestore"), ",")[0]
+		if field == "" || field == "-" {
+			continue
+		}
+
+		if reflect.DeepEqual(beforeValue.Field(i).Interface(), afterValue.Field(i).Interface()) {
+			continue
+		}
+
+		updates = append(updates, firestore.Update{Path: field, Value: afterValue.Field(i).Interface()})
+	}
+
+	return updates
+}
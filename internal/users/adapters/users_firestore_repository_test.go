@@ -0,0 +1,38 @@
+package adapters_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"github.com/shotokan/firebase-training/internal/users/adapters"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestUserFirestoreRepository only runs against the emulator, the contract
+// writes users:
+//
+//	FIRESTORE_EMULATOR_HOST=localhost:8081 go test ./internal/users/adapters
+func TestUserFirestoreRepository(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+	projectID := os.Getenv("GCP_PROJECT")
+	if projectID == "" {
+		projectID = "demo-users"
+	}
+
+	client, err := firestore.NewClient(context.Background(), projectID)
+	if err != nil {
+		t.Fatalf("creating firestore client: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	hasher, err := adapters.NewBcryptPasswordHasher(bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("creating password hasher: %v", err)
+	}
+
+	testUserRepository(t, adapters.NewUserFirestoreRepository(client, hasher))
+}
@@ -0,0 +1,487 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shotokan/firebase-training/internal/users/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// watcherBufferSize is how many changes a watcher can lag behind.
+const watcherBufferSize = 256
+
+var errWatcherFellBehind = errors.New("user watcher fell behind the changes")
+
+// UserMemoryRepository keeps users in process memory. It mirrors the
+// semantics of UserRepository, so it can replace Firestore in tests and
+// offline development.
+type UserMemoryRepository struct {
+	users map[string]User
+	// updateTimes plays the role of the update time of Firestore documents.
+	updateTimes map[string]time.Time
+	// emails maps normalized emails to the ID of the user owning them.
+	emails map[string]string
+	// watchers receive the changes of users, see WatchUsers.
+	watchers map[chan models.UserChange]struct{}
+	lock     *sync.RWMutex
+}
+
+func NewUserMemoryRepository() *UserMemoryRepository {
+	return &UserMemoryRepository{
+		users:       map[string]User{},
+		updateTimes: map[string]time.Time{},
+		emails:      map[string]string{},
+		watchers:    map[chan models.UserChange]struct{}{},
+		lock:        &sync.RWMutex{},
+	}
+}
+
+func (repo UserMemoryRepository) AddUser(ctx context.Context, user models.User) (models.User, error) {
+	actor, err := auditActor(ctx)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	return repo.addUser(user, actor)
+}
+
+// AddUsers adds every user on its own, like the BulkWriter of Firestore. It
+// returns the error of every user, nil for the users created.
+func (repo UserMemoryRepository) AddUsers(ctx context.Context, users []models.User) ([]error, error) {
+	actor, err := auditActor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	errs := make([]error, len(users))
+	for i, user := range users {
+		_, errs[i] = repo.addUser(user, actor)
+	}
+
+	return errs, nil
+}
+
+// addUser stores a new user. Callers must hold the write lock.
+func (repo UserMemoryRepository) addUser(user models.User, actor string) (models.User, error) {
+	userDto := marshalUser(user)
+
+	// Same error as returned by Firestore when tx.Create hits an existing document.
+	if _, ok := repo.users[userDto.ID]; ok {
+		return models.User{}, status.Errorf(codes.AlreadyExists, "Document already exists: users/%s", userDto.ID)
+	}
+	if err := repo.checkEmailAvailable(userDto.Email, userDto.ID); err != nil {
+		return models.User{}, err
+	}
+
+	// The update time stands in for the server timestamp.
+	updateTime := nextUpdateTime(time.Time{})
+	keepAuditFields(User{CreatedAt: updateTime, CreatedBy: actor, UpdatedAt: updateTime, UpdatedBy: actor}, &userDto)
+
+	repo.users[userDto.ID] = userDto
+	repo.updateTimes[userDto.ID] = updateTime
+	repo.emails[models.NormalizedEmail(userDto.Email)] = userDto.ID
+
+	storedUser, err := repo.unmarshalStoredUser(userDto)
+	if err != nil {
+		return models.User{}, err
+	}
+	repo.notifyWatchers(models.NewUserChange(storedUser))
+
+	return storedUser, nil
+}
+
+func (repo UserMemoryRepository) GetUser(_ context.Context, userID uuid.UUID) (models.User, error) {
+	repo.lock.RLock()
+	defer repo.lock.RUnlock()
+
+	userDto, ok := repo.users[userID.String()]
+	if !ok {
+		return models.User{}, models.ErrUserNotFound
+	}
+
+	return repo.unmarshalStoredUser(userDto)
+}
+
+func (repo UserMemoryRepository) GetUsersByID(_ context.Context, userIDs []uuid.UUID) ([]*models.User, error) {
+	repo.lock.RLock()
+	defer repo.lock.RUnlock()
+
+	users := make([]*models.User, len(userIDs))
+	for i, userID := range userIDs {
+		userDto, ok := repo.users[userID.String()]
+		if !ok {
+			continue
+		}
+
+		user, err := repo.unmarshalStoredUser(userDto)
+		if err != nil {
+			return nil, err
+		}
+		users[i] = &user
+	}
+
+	return users, nil
+}
+
+// ListUsers evaluates the query the way Firestore does, including the
+// combinations of filters and sort it rejects.
+func (repo UserMemoryRepository) ListUsers(_ context.Context, query models.UserQuery) (models.UserPage, error) {
+	sortBy, err := resolveUserSort(query)
+	if err != nil {
+		return models.UserPage{}, err
+	}
+
+	repo.lock.RLock()
+	defer repo.lock.RUnlock()
+
+	var after *User
+	if query.After != nil {
+		after = &User{
+			ID:              query.After.ID,
+			Name:            query.After.Name,
+			NormalizedEmail: query.After.NormalizedEmail,
+			CreatedAt:       query.After.CreatedAt,
+		}
+	}
+
+	userDtos := make([]User, 0, len(repo.users))
+	for _, userDto := range repo.users {
+		if !matchesUserFilter(userDto, query.Filter) {
+			continue
+		}
+		if after != nil && compareUsers(userDto, *after, sortBy) <= 0 {
+			continue
+		}
+		userDtos = append(userDtos, userDto)
+	}
+	sort.Slice(userDtos, func(i, j int) bool {
+		return compareUsers(userDtos[i], userDtos[j], sortBy) < 0
+	})
+
+	page := models.UserPage{Users: make([]models.User, 0, query.Limit)}
+	for i, userDto := range userDtos {
+		if i == query.Limit {
+			cursor := models.NewUserCursor(page.Users[i-1])
+			page.Next = &cursor
+			break
+		}
+
+		user, err := repo.unmarshalStoredUser(userDto)
+		if err != nil {
+			return models.UserPage{}, err
+		}
+		page.Users = append(page.Users, user)
+	}
+
+	return page, nil
+}
+
+func (repo UserMemoryRepository) ExportUsers(_ context.Context, includeDeleted bool, fn func(user models.User) error) error {
+	repo.lock.RLock()
+	users := make([]models.User, 0, len(repo.users))
+	for _, userDto := range repo.users {
+		if !includeDeleted && userDto.DeletedAt != nil {
+			continue
+		}
+
+		user, err := repo.unmarshalStoredUser(userDto)
+		if err != nil {
+			repo.lock.RUnlock()
+			return err
+		}
+		user.PasswordHash = ""
+		users = append(users, user)
+	}
+	// fn may be slow, writers must not wait for it.
+	repo.lock.RUnlock()
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID.String() < users[j].ID.String()
+	})
+
+	for _, user := range users {
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (repo UserMemoryRepository) UpdateUser(
+	ctx context.Context,
+	userID uuid.UUID,
+	precondition models.Precondition,
+	updateFn func(ctx context.Context, user *models.User) (*models.User, error),
+) (models.User, error) {
+	actor, err := auditActor(ctx)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	userDto, ok := repo.users[userID.String()]
+	if !ok {
+		return models.User{}, models.ErrUserNotFound
+	}
+
+	user, err := repo.unmarshalStoredUser(userDto)
+	if err != nil {
+		return models.User{}, err
+	}
+	if err := precondition.Check(user); err != nil {
+		return models.User{}, err
+	}
+
+	updatedUser, err := updateFn(ctx, &user)
+	if err != nil {
+		return models.User{}, err
+	}
+	updatedUser.ID = userID
+
+	updatedUserDto := marshalUser(*updatedUser)
+	keepAuditFields(userDto, &updatedUserDto)
+	if err := repo.checkEmailAvailable(updatedUserDto.Email, updatedUserDto.ID); err != nil {
+		return models.User{}, err
+	}
+
+	// Like Firestore, writing a document without changes keeps its update time.
+	changed := !reflect.DeepEqual(updatedUserDto, userDto)
+	if changed {
+		updateTime := nextUpdateTime(repo.updateTimes[updatedUserDto.ID])
+		updatedUserDto.UpdatedAt = updateTime
+		updatedUserDto.UpdatedBy = actor
+
+		delete(repo.emails, models.NormalizedEmail(userDto.Email))
+		repo.emails[models.NormalizedEmail(updatedUserDto.Email)] = updatedUserDto.ID
+		repo.users[updatedUserDto.ID] = updatedUserDto
+		repo.updateTimes[updatedUserDto.ID] = updateTime
+	}
+
+	storedUser, err := repo.unmarshalStoredUser(updatedUserDto)
+	if err != nil {
+		return models.User{}, err
+	}
+	if changed {
+		repo.notifyWatchers(models.NewUserChange(storedUser))
+	}
+
+	return storedUser, nil
+}
+
+func (repo UserMemoryRepository) DeleteUser(ctx context.Context, userID uuid.UUID) error {
+	if _, err := auditActor(ctx); err != nil {
+		return err
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	userDto, ok := repo.users[userID.String()]
+	if !ok {
+		return models.ErrUserNotFound
+	}
+
+	repo.removeUser(userDto)
+
+	return nil
+}
+
+func (repo UserMemoryRepository) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int, error) {
+	if _, err := auditActor(ctx); err != nil {
+		return 0, err
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	purged := 0
+	for _, userDto := range repo.users {
+		if userDto.DeletedAt == nil || !userDto.DeletedAt.Before(deletedBefore) {
+			continue
+		}
+
+		repo.removeUser(userDto)
+		purged++
+	}
+
+	return purged, nil
+}
+
+// WatchUsers replays the changes after position from the stored users, then
+// reports changes as they are written. A watcher reading slower than users
+// change is dropped with errWatcherFellBehind, it can resume from its last
+// change.
+func (repo UserMemoryRepository) WatchUsers(
+	ctx context.Context,
+	after *models.UserChangePosition,
+	fn func(change models.UserChange) error,
+) error {
+	changes := make(chan models.UserChange, watcherBufferSize)
+
+	repo.lock.Lock()
+	var missed []models.UserChange
+	if after != nil {
+		for _, userDto := range repo.users {
+			user, err := repo.unmarshalStoredUser(userDto)
+			if err != nil {
+				repo.lock.Unlock()
+				return err
+			}
+			if change := models.NewUserChange(user); change.Position.After(*after) {
+				missed = append(missed, change)
+			}
+		}
+	}
+	// Registered with the lock held, no change is lost between the replay
+	// and the live changes.
+	repo.watchers[changes] = struct{}{}
+	repo.lock.Unlock()
+
+	defer func() {
+		repo.lock.Lock()
+		delete(repo.watchers, changes)
+		repo.lock.Unlock()
+	}()
+
+	sort.Slice(missed, func(i, j int) bool {
+		return missed[j].Position.After(missed[i].Position)
+	})
+	for _, change := range missed {
+		if err := fn(change); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case change, ok := <-changes:
+			if !ok {
+				return errWatcherFellBehind
+			}
+			if err := fn(change); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// notifyWatchers sends change to all watchers, without waiting for them.
+// Callers must hold the write lock.
+func (repo UserMemoryRepository) notifyWatchers(change models.UserChange) {
+	for watcher := range repo.watchers {
+		select {
+		case watcher <- change:
+		default:
+			close(watcher)
+			delete(repo.watchers, watcher)
+		}
+	}
+}
+
+// removeUser deletes a user for good. Callers must hold the write lock.
+func (repo UserMemoryRepository) removeUser(userDto User) {
+	removeTime := nextUpdateTime(repo.updateTimes[userDto.ID])
+
+	user, err := repo.unmarshalStoredUser(userDto)
+	if err == nil {
+		repo.notifyWatchers(models.NewUserRemoval(user, removeTime))
+	}
+
+	delete(repo.emails, models.NormalizedEmail(userDto.Email))
+	delete(repo.users, userDto.ID)
+	delete(repo.updateTimes, userDto.ID)
+}
+
+func (repo UserMemoryRepository) unmarshalStoredUser(userDto User) (models.User, error) {
+	user, err := unmarshalUser(userDto)
+	if err != nil {
+		return models.User{}, err
+	}
+	user.UpdateTime = repo.updateTimes[userDto.ID]
+
+	return user, nil
+}
+
+// nextUpdateTime returns the current time, moved after the previous update
+// time if needed, so every version of a user has its own update time.
+func nextUpdateTime(previous time.Time) time.Time {
+	now := time.Now().UTC()
+	if !now.After(previous) {
+		return previous.Add(time.Nanosecond)
+	}
+
+	return now
+}
+
+// checkEmailAvailable fails with models.ErrEmailAlreadyExists when the email
+// belongs to a user other than userID. Callers must hold the write lock.
+func (repo UserMemoryRepository) checkEmailAvailable(email string, userID string) error {
+	owner, ok := repo.emails[models.NormalizedEmail(email)]
+	if ok && owner != userID {
+		return models.ErrEmailAlreadyExists
+	}
+
+	return nil
+}
+
+func matchesUserFilter(userDto User, filter models.UserFilter) bool {
+	if filter.Role != "" && userDto.Role != filter.Role {
+		return false
+	}
+	if !filter.IncludeDeleted && userDto.DeletedAt != nil {
+		return false
+	}
+	if filter.EmailPrefix != "" && !strings.HasPrefix(userDto.NormalizedEmail, models.NormalizedEmail(filter.EmailPrefix)) {
+		return false
+	}
+	if filter.CreatedFrom != nil && userDto.CreatedAt.Before(*filter.CreatedFrom) {
+		return false
+	}
+	if filter.CreatedTo != nil && !userDto.CreatedAt.Before(*filter.CreatedTo) {
+		return false
+	}
+
+	return true
+}
+
+// compareUsers orders users by the sort field, then by ID, in the direction
+// of the sort.
+func compareUsers(a, b User, sortBy models.UserSort) int {
+	var result int
+	switch sortBy.Field {
+	case models.UserSortByName:
+		result = strings.Compare(a.Name, b.Name)
+	case models.UserSortByEmail:
+		result = strings.Compare(a.NormalizedEmail, b.NormalizedEmail)
+	case models.UserSortByCreatedAt:
+		result = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if result == 0 {
+		result = strings.Compare(a.ID, b.ID)
+	}
+
+	if sortBy.Descending {
+		return -result
+	}
+
+	return result
+}
@@ -0,0 +1,11 @@
+package adapters_test
+
+import (
+	"testing"
+
+	"github.com/shotokan/firebase-training/internal/users/adapters"
+)
+
+func TestUserMemoryRepository(t *testing.T) {
+	testUserRepository(t, adapters.NewUserMemoryRepository())
+}
@@ -0,0 +1,762 @@
+package adapters_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shotokan/firebase-training/internal/common"
+	"github.com/shotokan/firebase-training/internal/users/models"
+	"github.com/shotokan/firebase-training/internal/users/ports"
+)
+
+const concurrentWriters = 8
+
+// watchTimeout bounds the wait for every change in testWatch.
+const watchTimeout = 10 * time.Second
+
+// principal is the user all cases write as.
+var principal = common.User{UUID: "repository-contract", Role: models.RoleAdmin, DisplayName: "Repository contract"}
+
+// purgedDeletedAt is when testSoftDeleteAndPurge soft-deletes its users, long
+// before any other user, so its purge only removes users of that case.
+var purgedDeletedAt = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// testUserRepository runs the contract every ports.UserRepository adapter
+// must honour, so all backends behave the same.
+//
+// Cases don't need an empty repository: every case works with its own users,
+// found by a unique email prefix, and only checks those, so the contract can
+// run against a shared Firestore emulator.
+func testUserRepository(t *testing.T, repo ports.UserRepository) {
+	cases := []struct {
+		name string
+		run  func(t *testing.T, repo ports.UserRepository)
+	}{
+		{"create and get", testCreateAndGet},
+		{"create duplicate", testCreateDuplicate},
+		{"create batch", testCreateBatch},
+		{"get missing", testGetMissing},
+		{"get batch", testGetBatch},
+		{"list ordering", testListOrdering},
+		{"list pagination", testListPagination},
+		{"export", testExport},
+		{"update", testUpdate},
+		{"update precondition", testUpdatePrecondition},
+		{"update email", testUpdateEmail},
+		{"delete", testDelete},
+		{"soft delete and purge", testSoftDeleteAndPurge},
+		{"watch", testWatch},
+		{"writes need a principal", testWritesNeedPrincipal},
+		{"concurrent creates", testConcurrentCreates},
+		{"concurrent updates", testConcurrentUpdates},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			c.run(t, repo)
+		})
+	}
+}
+
+func testCreateAndGet(t *testing.T, repo ports.UserRepository) {
+	ctx := principalContext()
+	user := newUser(emailPrefix()+"amy@example.com", "Amy")
+
+	created, err := repo.AddUser(ctx, user)
+	if err != nil {
+		t.Fatalf("adding user: %v", err)
+	}
+	expectSameFields(t, user, created)
+	if created.CreatedAt.IsZero() || created.UpdatedAt.IsZero() || created.UpdateTime.IsZero() {
+		t.Fatalf("added user has no timestamps: %+v", created)
+	}
+	if created.CreatedBy != principal.UUID || created.UpdatedBy != principal.UUID {
+		t.Fatalf("added user was written by %q/%q, want %q", created.CreatedBy, created.UpdatedBy, principal.UUID)
+	}
+
+	got, err := repo.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("getting user: %v", err)
+	}
+	expectSameUser(t, created, got)
+}
+
+func testCreateDuplicate(t *testing.T, repo ports.UserRepository) {
+	ctx := principalContext()
+	email := emailPrefix() + "amy@example.com"
+	user := newUser(email, "Amy")
+	if _, err := repo.AddUser(ctx, user); err != nil {
+		t.Fatalf("adding user: %v", err)
+	}
+
+	sameID := newUser(emailPrefix()+"bo@example.com", "Bo")
+	sameID.ID = user.ID
+	if _, err := repo.AddUser(ctx, sameID); err == nil {
+		t.Fatal("adding a user with a used ID succeeded")
+	}
+
+	sameEmail := newUser("  "+strings.ToUpper(email), "Amy again")
+	if _, err := repo.AddUser(ctx, sameEmail); !errors.Is(err, models.ErrEmailAlreadyExists) {
+		t.Fatalf("adding a user with a used email: got %v, want %v", err, models.ErrEmailAlreadyExists)
+	}
+
+	got, err := repo.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("getting user: %v", err)
+	}
+	expectSameFields(t, user, got)
+}
+
+func testCreateBatch(t *testing.T, repo ports.UserRepository) {
+	ctx := principalContext()
+	prefix := emailPrefix()
+	existing := newUser(prefix+"amy@example.com", "Amy")
+	if _, err := repo.AddUser(ctx, existing); err != nil {
+		t.Fatalf("adding user: %v", err)
+	}
+
+	batch := []models.User{
+		newUser(prefix+"bo@example.com", "Bo"),
+		newUser(strings.ToUpper(existing.Email), "Amy again"),
+		newUser(prefix+"cy@example.com", "Cy"),
+		newUser(prefix+"CY@example.com", "Cy again"),
+	}
+	errs, err := repo.AddUsers(ctx, batch)
+	if err != nil {
+		t.Fatalf("adding users: %v", err)
+	}
+	if len(errs) != len(batch) {
+		t.Fatalf("got %d results for %d users", len(errs), len(batch))
+	}
+
+	for i, wantErr := range []error{nil, models.ErrEmailAlreadyExists, nil, models.ErrEmailAlreadyExists} {
+		if !errors.Is(errs[i], wantErr) {
+			t.Fatalf("user %d: got %v, want %v", i, errs[i], wantErr)
+		}
+
+		got, err := repo.GetUser(ctx, batch[i].ID)
+		if wantErr != nil {
+			if !errors.Is(err, models.ErrUserNotFound) {
+				t.Fatalf("user %d wasn't created, but getting it returned %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("getting user %d: %v", i, err)
+		}
+		expectSameFields(t, batch[i], got)
+		if got.CreatedBy != principal.UUID || got.CreatedAt.IsZero() {
+			t.Fatalf("user %d has no audit metadata: %+v", i, got)
+		}
+	}
+}
+
+func testGetMissing(t *testing.T, repo ports.UserRepository) {
+	_, err := repo.GetUser(principalContext(), uuid.New())
+	if !errors.Is(err, models.ErrUserNotFound) {
+		t.Fatalf("got %v, want %v", err, models.ErrUserNotFound)
+	}
+}
+
+func testGetBatch(t *testing.T, repo ports.UserRepository) {
+	ctx := principalContext()
+	prefix := emailPrefix()
+	amy, err := repo.AddUser(ctx, newUser(prefix+"amy@example.com", "Amy"))
+	if err != nil {
+		t.Fatalf("adding user: %v", err)
+	}
+	bo, err := repo.AddUser(ctx, newUser(prefix+"bo@example.com", "Bo"))
+	if err != nil {
+		t.Fatalf("adding user: %v", err)
+	}
+
+	// Order and duplicates of the request are kept.
+	ids := []uuid.UUID{bo.ID, uuid.New(), amy.ID, bo.ID}
+	users, err := repo.GetUsersByID(ctx, ids)
+	if err != nil {
+		t.Fatalf("getting users: %v", err)
+	}
+	if len(users) != len(ids) {
+		t.Fatalf("got %d users for %d IDs", len(users), len(ids))
+	}
+	if users[1] != nil {
+		t.Fatalf("got %+v for a missing user", users[1])
+	}
+
+	for i, want := range []models.User{bo, {}, amy, bo} {
+		if i == 1 {
+			continue
+		}
+		if users[i] == nil {
+			t.Fatalf("user %s is missing", ids[i])
+		}
+		expectSameUser(t, want, *users[i])
+	}
+}
+
+func testListOrdering(t *testing.T, repo ports.UserRepository) {
+	ctx := principalContext()
+	prefix := emailPrefix()
+	for _, name := range []string{"c", "a", "b"} {
+		if _, err := repo.AddUser(ctx, newUser(prefix+name+"@example.com", name)); err != nil {
+			t.Fatalf("adding user: %v", err)
+		}
+	}
+
+	for _, descending := range []bool{false, true} {
+		page, err := repo.ListUsers(ctx, models.UserQuery{
+			Filter: models.UserFilter{EmailPrefix: strings.ToUpper(prefix)},
+			Sort:   models.UserSort{Field: models.UserSortByEmail, Descending: descending},
+			Limit:  10,
+		})
+		if err != nil {
+			t.Fatalf("listing users: %v", err)
+		}
+
+		want := []string{"a", "b", "c"}
+		if descending {
+			want = []string{"c", "b", "a"}
+		}
+		if got := userNames(page.Users); !equalStrings(got, want) {
+			t.Fatalf("descending %t: got %v, want %v", descending, got, want)
+		}
+		if page.Next != nil {
+			t.Fatalf("descending %t: complete page has a next cursor", descending)
+		}
+	}
+}
+
+func testListPagination(t *testing.T, repo ports.UserRepository) {
+	ctx := principalContext()
+	prefix := emailPrefix()
+	var want []string
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("user-%d", i)
+		if _, err := repo.AddUser(ctx, newUser(fmt.Sprintf("%s%d@example.com", prefix, i), name)); err != nil {
+			t.Fatalf("adding user: %v", err)
+		}
+		want = append(want, name)
+	}
+
+	query := models.UserQuery{
+		Filter: models.UserFilter{EmailPrefix: prefix},
+		Sort:   models.UserSort{Field: models.UserSortByEmail},
+		Limit:  2,
+	}
+
+	var got []string
+	var pageSizes []int
+	for {
+		page, err := repo.ListUsers(ctx, query)
+		if err != nil {
+			t.Fatalf("listing users: %v", err)
+		}
+		got = append(got, userNames(page.Users)...)
+		pageSizes = append(pageSizes, len(page.Users))
+
+		if page.Next == nil {
+			break
+		}
+		if len(pageSizes) > len(want) {
+			t.Fatal("pagination doesn't end")
+		}
+		query.After = page.Next
+	}
+
+	if !equalStrings(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if fmt.Sprint(pageSizes) != "[2 2 1]" {
+		t.Fatalf("got pages of %v users, want [2 2 1]", pageSizes)
+	}
+}
+
+func testExport(t *testing.T, repo ports.UserRepository) {
+	ctx := principalContext()
+	prefix := emailPrefix()
+	var created []models.User
+	for _, name := range []string{"a", "b", "c"} {
+		user, err := repo.AddUser(ctx, newUser(prefix+name+"@example.com", name))
+		if err != nil {
+			t.Fatalf("adding user: %v", err)
+		}
+		created = append(created, user)
+	}
+
+	deleted := created[2]
+	_, err := repo.UpdateUser(ctx, deleted.ID, models.Precondition{}, func(_ context.Context, u *models.User) (*models.User, error) {
+		return u, u.SoftDelete(time.Now().UTC())
+	})
+	if err != nil {
+		t.Fatalf("soft-deleting user: %v", err)
+	}
+
+	for _, includeDeleted := range []bool{false, true} {
+		var exported []models.User
+		lastID := ""
+		err := repo.ExportUsers(ctx, includeDeleted, func(user models.User) error {
+			if user.ID.String() <= lastID {
+				return fmt.Errorf("user %s exported after %s", user.ID, lastID)
+			}
+			lastID = user.ID.String()
+
+			if user.PasswordHash != "" {
+				return fmt.Errorf("user %s exported with its password hash", user.ID)
+			}
+			if strings.HasPrefix(user.Email, prefix) {
+				exported = append(exported, user)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("includeDeleted %t: exporting users: %v", includeDeleted, err)
+		}
+
+		want := 2
+		if includeDeleted {
+			want = 3
+		}
+		if len(exported) != want {
+			t.Fatalf("includeDeleted %t: exported %d users, want %d", includeDeleted, len(exported), want)
+		}
+	}
+}
+
+func testUpdate(t *testing.T, repo ports.UserRepository) {
+	ctx := principalContext()
+	created, err := repo.AddUser(ctx, newUser(emailPrefix()+"amy@example.com", "Amy"))
+	if err != nil {
+		t.Fatalf("adding user: %v", err)
+	}
+
+	editor := common.User{UUID: "repository-contract-editor"}
+	updated, err := repo.UpdateUser(
+		common.WithUser(ctx, editor),
+		created.ID,
+		models.Precondition{},
+		func(_ context.Context, u *models.User) (*models.User, error) {
+			u.Name = "Amy Pond"
+			// Audit metadata belongs to the repository.
+			u.CreatedBy = "someone else"
+			return u, nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("updating user: %v", err)
+	}
+	if updated.Name != "Amy Pond" {
+		t.Fatalf("updated name is %q", updated.Name)
+	}
+	if updated.CreatedBy != created.CreatedBy || updated.UpdatedBy != editor.UUID {
+		t.Fatalf("updated user was written by %q/%q", updated.CreatedBy, updated.UpdatedBy)
+	}
+	if !updated.UpdateTime.After(created.UpdateTime) || updated.UpdatedAt.Before(created.UpdatedAt) {
+		t.Fatal("update didn't move the update time forward")
+	}
+
+	got, err := repo.GetUser(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("getting user: %v", err)
+	}
+	expectSameUser(t, updated, got)
+
+	unchanged, err := repo.UpdateUser(ctx, created.ID, models.Precondition{}, func(_ context.Context, u *models.User) (*models.User, error) {
+		return u, nil
+	})
+	if err != nil {
+		t.Fatalf("updating user without changes: %v", err)
+	}
+	if !unchanged.UpdateTime.Equal(updated.UpdateTime) || unchanged.UpdatedBy != editor.UUID {
+		t.Fatal("update without changes changed the version of the user")
+	}
+
+	_, err = repo.UpdateUser(ctx, uuid.New(), models.Precondition{}, func(_ context.Context, u *models.User) (*models.User, error) {
+		return u, nil
+	})
+	if !errors.Is(err, models.ErrUserNotFound) {
+		t.Fatalf("updating a missing user: got %v, want %v", err, models.ErrUserNotFound)
+	}
+}
+
+func testUpdatePrecondition(t *testing.T, repo ports.UserRepository) {
+	ctx := principalContext()
+	created, err := repo.AddUser(ctx, newUser(emailPrefix()+"amy@example.com", "Amy"))
+	if err != nil {
+		t.Fatalf("adding user: %v", err)
+	}
+	readVersion := models.Precondition{LastUpdateTime: created.UpdateTime}
+
+	if _, err := repo.UpdateUser(ctx, created.ID, readVersion, rename("Amy Pond")); err != nil {
+		t.Fatalf("updating the read version: %v", err)
+	}
+
+	_, err = repo.UpdateUser(ctx, created.ID, readVersion, rename("Amy Williams"))
+	if !errors.Is(err, models.ErrUserModified) {
+		t.Fatalf("updating a stale version: got %v, want %v", err, models.ErrUserModified)
+	}
+
+	got, err := repo.GetUser(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("getting user: %v", err)
+	}
+	if got.Name != "Amy Pond" {
+		t.Fatalf("stale update was written, name is %q", got.Name)
+	}
+}
+
+func testUpdateEmail(t *testing.T, repo ports.UserRepository) {
+	ctx := principalContext()
+	prefix := emailPrefix()
+	amy, err := repo.AddUser(ctx, newUser(prefix+"amy@example.com", "Amy"))
+	if err != nil {
+		t.Fatalf("adding user: %v", err)
+	}
+	bo, err := repo.AddUser(ctx, newUser(prefix+"bo@example.com", "Bo"))
+	if err != nil {
+		t.Fatalf("adding user: %v", err)
+	}
+
+	_, err = repo.UpdateUser(ctx, bo.ID, models.Precondition{}, changeEmail(strings.ToUpper(amy.Email)))
+	if !errors.Is(err, models.ErrEmailAlreadyExists) {
+		t.Fatalf("taking the email of another user: got %v, want %v", err, models.ErrEmailAlreadyExists)
+	}
+
+	if _, err := repo.UpdateUser(ctx, amy.ID, models.Precondition{}, changeEmail(prefix+"pond@example.com")); err != nil {
+		t.Fatalf("changing email: %v", err)
+	}
+	if _, err := repo.UpdateUser(ctx, bo.ID, models.Precondition{}, changeEmail(amy.Email)); err != nil {
+		t.Fatalf("taking a released email: %v", err)
+	}
+}
+
+func testDelete(t *testing.T, repo ports.UserRepository) {
+	ctx := principalContext()
+	user := newUser(emailPrefix()+"amy@example.com", "Amy")
+	if _, err := repo.AddUser(ctx, user); err != nil {
+		t.Fatalf("adding user: %v", err)
+	}
+
+	if err := repo.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatalf("deleting user: %v", err)
+	}
+	if _, err := repo.GetUser(ctx, user.ID); !errors.Is(err, models.ErrUserNotFound) {
+		t.Fatalf("getting deleted user: got %v, want %v", err, models.ErrUserNotFound)
+	}
+	if err := repo.DeleteUser(ctx, user.ID); !errors.Is(err, models.ErrUserNotFound) {
+		t.Fatalf("deleting deleted user: got %v, want %v", err, models.ErrUserNotFound)
+	}
+
+	reuse := newUser(user.Email, "Amy again")
+	if _, err := repo.AddUser(ctx, reuse); err != nil {
+		t.Fatalf("reusing the email of a deleted user: %v", err)
+	}
+}
+
+// testSoftDeleteAndPurge purges users soft-deleted before a cutoff shortly
+// after purgedDeletedAt. Other users, of other cases or runs, are all deleted
+// later, so the purge doesn't touch them.
+func testSoftDeleteAndPurge(t *testing.T, repo ports.UserRepository) {
+	ctx := principalContext()
+	prefix := emailPrefix()
+	purged, err := repo.AddUser(ctx, newUser(prefix+"amy@example.com", "Amy"))
+	if err != nil {
+		t.Fatalf("adding user: %v", err)
+	}
+	kept, err := repo.AddUser(ctx, newUser(prefix+"bo@example.com", "Bo"))
+	if err != nil {
+		t.Fatalf("adding user: %v", err)
+	}
+
+	cutoff := purgedDeletedAt.Add(time.Minute)
+	for _, user := range []struct {
+		id        uuid.UUID
+		deletedAt time.Time
+	}{
+		{purged.ID, purgedDeletedAt},
+		{kept.ID, cutoff.Add(time.Minute)},
+	} {
+		_, err = repo.UpdateUser(ctx, user.id, models.Precondition{}, func(_ context.Context, u *models.User) (*models.User, error) {
+			return u, u.SoftDelete(user.deletedAt)
+		})
+		if err != nil {
+			t.Fatalf("soft-deleting user: %v", err)
+		}
+	}
+
+	for _, includeDeleted := range []bool{false, true} {
+		page, err := repo.ListUsers(ctx, models.UserQuery{
+			Filter: models.UserFilter{EmailPrefix: prefix, IncludeDeleted: includeDeleted},
+			Sort:   models.UserSort{Field: models.UserSortByEmail},
+			Limit:  10,
+		})
+		if err != nil {
+			t.Fatalf("listing users: %v", err)
+		}
+		want := 0
+		if includeDeleted {
+			want = 2
+		}
+		if len(page.Users) != want {
+			t.Fatalf("includeDeleted %t: listed %d users, want %d", includeDeleted, len(page.Users), want)
+		}
+	}
+
+	if _, err := repo.PurgeDeletedUsers(ctx, cutoff); err != nil {
+		t.Fatalf("purging users: %v", err)
+	}
+	if _, err := repo.GetUser(ctx, purged.ID); !errors.Is(err, models.ErrUserNotFound) {
+		t.Fatalf("getting purged user: got %v, want %v", err, models.ErrUserNotFound)
+	}
+	got, err := repo.GetUser(ctx, kept.ID)
+	if err != nil {
+		t.Fatalf("getting user deleted after the cutoff: %v", err)
+	}
+	if !got.IsDeleted() {
+		t.Fatal("user deleted after the cutoff was restored")
+	}
+}
+
+func testWatch(t *testing.T, repo ports.UserRepository) {
+	ctx := principalContext()
+	prefix := emailPrefix()
+	amy, err := repo.AddUser(ctx, newUser(prefix+"amy@example.com", "Amy"))
+	if err != nil {
+		t.Fatalf("adding user: %v", err)
+	}
+	bo, err := repo.AddUser(ctx, newUser(prefix+"bo@example.com", "Bo"))
+	if err != nil {
+		t.Fatalf("adding user: %v", err)
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	changes := make(chan models.UserChange)
+	watchErr := make(chan error, 1)
+	after := models.NewUserChange(amy).Position
+	go func() {
+		watchErr <- repo.WatchUsers(watchCtx, &after, func(change models.UserChange) error {
+			if !strings.HasPrefix(change.User.Email, prefix) {
+				return nil
+			}
+			select {
+			case changes <- change:
+			case <-watchCtx.Done():
+			}
+			return nil
+		})
+	}()
+
+	// Resuming after Amy replays the creation of Bo only.
+	expectChange(t, changes, watchErr, models.UserCreated, bo.ID)
+
+	if _, err := repo.UpdateUser(ctx, amy.ID, models.Precondition{}, rename("Amy Pond")); err != nil {
+		t.Fatalf("updating user: %v", err)
+	}
+	expectChange(t, changes, watchErr, models.UserUpdated, amy.ID)
+
+	if err := repo.DeleteUser(ctx, bo.ID); err != nil {
+		t.Fatalf("deleting user: %v", err)
+	}
+	expectChange(t, changes, watchErr, models.UserDeleted, bo.ID)
+
+	cancel()
+	select {
+	case err := <-watchErr:
+		if err != nil {
+			t.Fatalf("stopping watch: %v", err)
+		}
+	case <-time.After(watchTimeout):
+		t.Fatal("watch didn't stop with its context")
+	}
+}
+
+func testWritesNeedPrincipal(t *testing.T, repo ports.UserRepository) {
+	anonymous := context.Background()
+
+	user := newUser(emailPrefix()+"amy@example.com", "Amy")
+	if _, err := repo.AddUser(anonymous, user); !errors.Is(err, common.NoUserInContextError) {
+		t.Fatalf("adding user without principal: got %v, want %v", err, common.NoUserInContextError)
+	}
+
+	if _, err := repo.AddUser(principalContext(), user); err != nil {
+		t.Fatalf("adding user: %v", err)
+	}
+	if _, err := repo.UpdateUser(anonymous, user.ID, models.Precondition{}, rename("Amy Pond")); !errors.Is(err, common.NoUserInContextError) {
+		t.Fatalf("updating user without principal: got %v, want %v", err, common.NoUserInContextError)
+	}
+
+	system, err := repo.UpdateUser(common.WithSystemOperation(anonymous), user.ID, models.Precondition{}, rename("Amy Pond"))
+	if err != nil {
+		t.Fatalf("updating user in a system operation: %v", err)
+	}
+	if system.UpdatedBy == "" || system.UpdatedBy == principal.UUID {
+		t.Fatalf("system operation was recorded as written by %q", system.UpdatedBy)
+	}
+}
+
+func testConcurrentCreates(t *testing.T, repo ports.UserRepository) {
+	ctx := principalContext()
+	email := emailPrefix() + "amy@example.com"
+
+	errs := make([]error, concurrentWriters)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentWriters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = repo.AddUser(ctx, newUser(email, fmt.Sprintf("Amy %d", i)))
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, models.ErrEmailAlreadyExists):
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("%d users were created with the same email, want 1", created)
+	}
+}
+
+func testConcurrentUpdates(t *testing.T, repo ports.UserRepository) {
+	ctx := principalContext()
+	created, err := repo.AddUser(ctx, newUser(emailPrefix()+"amy@example.com", "Amy"))
+	if err != nil {
+		t.Fatalf("adding user: %v", err)
+	}
+	readVersion := models.Precondition{LastUpdateTime: created.UpdateTime}
+
+	errs := make([]error, concurrentWriters)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentWriters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = repo.UpdateUser(ctx, created.ID, readVersion, rename(fmt.Sprintf("Amy %d", i)))
+		}(i)
+	}
+	wg.Wait()
+
+	winner := ""
+	for i, err := range errs {
+		switch {
+		case err == nil && winner != "":
+			t.Fatal("more than one update of the same version succeeded")
+		case err == nil:
+			winner = fmt.Sprintf("Amy %d", i)
+		case !errors.Is(err, models.ErrUserModified):
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if winner == "" {
+		t.Fatal("no update succeeded")
+	}
+
+	got, err := repo.GetUser(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("getting user: %v", err)
+	}
+	if got.Name != winner {
+		t.Fatalf("name is %q, want the successful update %q", got.Name, winner)
+	}
+}
+
+func principalContext() context.Context {
+	return common.WithUser(context.Background(), principal)
+}
+
+// emailPrefix is unique to a single run of a case.
+func emailPrefix() string {
+	return "contract-" + strings.ReplaceAll(uuid.NewString(), "-", "") + "-"
+}
+
+// expectChange waits for the next change reported by a watch.
+func expectChange(t *testing.T, changes <-chan models.UserChange, watchErr <-chan error, changeType models.UserChangeType, userID uuid.UUID) {
+	t.Helper()
+
+	select {
+	case change := <-changes:
+		if change.Type != changeType || change.User.ID != userID {
+			t.Fatalf("got %s change of %s, want %s change of %s", change.Type, change.User.ID, changeType, userID)
+		}
+	case err := <-watchErr:
+		t.Fatalf("watch stopped waiting for %s change of %s: %v", changeType, userID, err)
+	case <-time.After(watchTimeout):
+		t.Fatalf("no %s change of %s", changeType, userID)
+	}
+}
+
+func newUser(email string, name string) models.User {
+	return models.User{
+		ID:           uuid.New(),
+		Name:         name,
+		Email:        email,
+		PasswordHash: "hash-of-" + name,
+		Role:         models.RoleUser,
+		AuthSubject:  "subject-of-" + name,
+		Profile:      models.UserProfile{Locale: "en-GB", Timezone: "Europe/London", Bio: "Hi, I'm " + name},
+	}
+}
+
+func rename(name string) func(context.Context, *models.User) (*models.User, error) {
+	return func(_ context.Context, u *models.User) (*models.User, error) {
+		u.Name = name
+		return u, nil
+	}
+}
+
+func changeEmail(email string) func(context.Context, *models.User) (*models.User, error) {
+	return func(_ context.Context, u *models.User) (*models.User, error) {
+		u.Email = email
+		return u, nil
+	}
+}
+
+// expectSameFields compares the fields set by callers, ignoring what the
+// repository stamps.
+func expectSameFields(t *testing.T, want, got models.User) {
+	t.Helper()
+
+	if got.ID != want.ID || got.Name != want.Name || got.Email != want.Email ||
+		got.PasswordHash != want.PasswordHash || got.Role != want.Role || got.AuthSubject != want.AuthSubject || got.Profile != want.Profile {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func expectSameUser(t *testing.T, want, got models.User) {
+	t.Helper()
+
+	expectSameFields(t, want, got)
+	if !got.CreatedAt.Equal(want.CreatedAt) || !got.UpdatedAt.Equal(want.UpdatedAt) ||
+		!got.UpdateTime.Equal(want.UpdateTime) ||
+		got.CreatedBy != want.CreatedBy || got.UpdatedBy != want.UpdatedBy ||
+		(got.DeletedAt == nil) != (want.DeletedAt == nil) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func userNames(users []models.User) []string {
+	names := make([]string, 0, len(users))
+	for _, u := range users {
+		names = append(names, u.Name)
+	}
+
+	return names
+}
+
+func equalStrings(a, b []string) bool {
+	return strings.Join(a, "\x00") == strings.Join(b, "\x00")
+}
@@ -1,10 +1,224 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"net/mail"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/shotokan/firebase-training/internal/common/errors"
+)
+
+var (
+	ErrUserNotFound       = errors.NewNotFoundError("user not found", "user-not-found")
+	ErrEmailAlreadyExists = errors.NewConflictError("email is already used by another user", "email-already-exists")
+	ErrUserNotDeleted     = errors.NewConflictError("user is not deleted", "user-not-deleted")
+	ErrUserModified       = errors.NewPreconditionFailedError("user was modified since it was read", "user-modified")
+
+	ErrEmptyName         = errors.NewIncorrectInputError("name can't be empty", "empty-name")
+	ErrNameTooLong       = errors.NewIncorrectInputError("name is too long", "name-too-long")
+	ErrInvalidEmail      = errors.NewIncorrectInputError("email is not a valid address", "invalid-email")
+	ErrInvalidRole       = errors.NewIncorrectInputError("role is not a known role", "invalid-role")
+	ErrMissingPassword   = errors.NewIncorrectInputError("password is required", "missing-password")
+	ErrPasswordTooShort  = errors.NewIncorrectInputError("password is too short", "password-too-short")
+	ErrPasswordTooLong   = errors.NewIncorrectInputError("password is too long", "password-too-long")
+	ErrPasswordTooSimple = errors.NewIncorrectInputError("password must mix letters with digits or symbols", "password-too-simple")
+)
+
+const (
+	maxNameLength = 100
+	// maxEmailLength is the longest address allowed in SMTP paths.
+	maxEmailLength    = 254
+	minPasswordLength = 8
+	// maxPasswordBytes is the longest password bcrypt can hash.
+	maxPasswordBytes = 72
+)
+
+const (
+	RoleUser    = "user"
+	RoleTrainer = "trainer"
+	RoleAdmin   = "admin"
+)
 
 type User struct {
-	ID       uuid.UUID
-	Name     string
-	Email    string
-	Password string
+	ID    uuid.UUID
+	Name  string
+	Email string
+	// PasswordHash is never the plaintext password, it is hashed before
+	// the user reaches the repository.
+	PasswordHash string
+	Role         string
+	// AuthSubject is the subject of the tokens of the person owning the
+	// user, empty for users nobody owns.
+	AuthSubject string
+	Profile     UserProfile
+	// CreatedAt, UpdatedAt, CreatedBy and UpdatedBy are audit metadata,
+	// stamped by the repository on every write.
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	CreatedBy string
+	UpdatedBy string
+	// DeletedAt is set while the user is soft-deleted, until it is restored
+	// or purged.
+	DeletedAt *time.Time
+	// UpdateTime is set by the repository on every write, it identifies the
+	// version of the user.
+	UpdateTime time.Time
+}
+
+// NewUser creates a user, failing with an incorrect input error when any of
+// the fields is invalid. The password must already be hashed, see
+// ValidatePassword for the rules of plaintext passwords.
+func NewUser(id uuid.UUID, name string, email string, role string, passwordHash string) (User, error) {
+	u := User{ID: id}
+
+	if err := u.ChangeName(name); err != nil {
+		return User{}, err
+	}
+	if err := u.ChangeEmail(email); err != nil {
+		return User{}, err
+	}
+	if err := u.ChangeRole(role); err != nil {
+		return User{}, err
+	}
+	if err := u.ChangePasswordHash(passwordHash); err != nil {
+		return User{}, err
+	}
+
+	return u, nil
+}
+
+func (u *User) ChangeName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return ErrEmptyName
+	}
+	if utf8.RuneCountInString(name) > maxNameLength {
+		return ErrNameTooLong
+	}
+
+	u.Name = name
+
+	return nil
+}
+
+// ChangeEmail accepts bare addresses only, without display names like
+// "Amy <amy@example.com>".
+func (u *User) ChangeEmail(email string) error {
+	if len(email) > maxEmailLength {
+		return ErrInvalidEmail
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != email {
+		return ErrInvalidEmail
+	}
+
+	u.Email = email
+
+	return nil
+}
+
+func (u *User) ChangeRole(role string) error {
+	switch role {
+	case RoleUser, RoleTrainer, RoleAdmin:
+	default:
+		return ErrInvalidRole
+	}
+
+	u.Role = role
+
+	return nil
+}
+
+func (u *User) ChangePasswordHash(passwordHash string) error {
+	if passwordHash == "" {
+		return ErrMissingPassword
+	}
+
+	u.PasswordHash = passwordHash
+
+	return nil
+}
+
+// ChangeProfile replaces the whole profile, which must come from
+// NewUserProfile.
+func (u *User) ChangeProfile(profile UserProfile) {
+	u.Profile = profile
+}
+
+// ValidatePassword checks the strength of a plaintext password, before it is
+// hashed.
+func ValidatePassword(password string) error {
+	if password == "" {
+		return ErrMissingPassword
+	}
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return ErrPasswordTooShort
+	}
+	if len(password) > maxPasswordBytes {
+		return ErrPasswordTooLong
+	}
+
+	hasLetter, hasOther := false, false
+	for _, r := range password {
+		if unicode.IsLetter(r) {
+			hasLetter = true
+		} else {
+			hasOther = true
+		}
+	}
+	if !hasLetter || !hasOther {
+		return ErrPasswordTooSimple
+	}
+
+	return nil
+}
+
+// Precondition guards writes against concurrent modifications. The zero
+// value always holds.
+type Precondition struct {
+	// LastUpdateTime must be the UpdateTime of the stored user.
+	LastUpdateTime time.Time
+}
+
+// Check fails with ErrUserModified unless the user satisfies the precondition.
+func (p Precondition) Check(user User) error {
+	if p.LastUpdateTime.IsZero() || p.LastUpdateTime.Equal(user.UpdateTime) {
+		return nil
+	}
+
+	return ErrUserModified
+}
+
+func (u User) IsDeleted() bool {
+	return u.DeletedAt != nil
+}
+
+// SoftDelete marks the user as deleted. Deleted users are hidden, as if they
+// didn't exist, so deleting them again fails with ErrUserNotFound.
+func (u *User) SoftDelete(at time.Time) error {
+	if u.IsDeleted() {
+		return ErrUserNotFound
+	}
+
+	u.DeletedAt = &at
+
+	return nil
+}
+
+func (u *User) Restore() error {
+	if !u.IsDeleted() {
+		return ErrUserNotDeleted
+	}
+
+	u.DeletedAt = nil
+
+	return nil
+}
+
+// NormalizedEmail is the form of the email used to enforce uniqueness, emails
+// differing only in case or surrounding spaces belong to the same user.
+func NormalizedEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
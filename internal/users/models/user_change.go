@@ -0,0 +1,70 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+type UserChangeType string
+
+const (
+	UserCreated UserChangeType = "created"
+	UserUpdated UserChangeType = "updated"
+	// UserDeleted is reported for soft deletes, and again when the user is
+	// removed for good.
+	UserDeleted UserChangeType = "deleted"
+)
+
+// UserChange is a change of a user, as reported by a watch.
+type UserChange struct {
+	Type UserChangeType
+	// User is the user after the change, or its last version when it was
+	// removed.
+	User     User
+	Position UserChangePosition
+}
+
+// UserChangePosition orders the changes of all users. A watch resumed from
+// a position reports the changes after it.
+type UserChangePosition struct {
+	// Time is the UpdatedAt of the user. Users changed together share it.
+	Time   time.Time
+	UserID string
+}
+
+// After reports whether p is after other, changes at the same time are
+// ordered by user ID.
+func (p UserChangePosition) After(other UserChangePosition) bool {
+	if !p.Time.Equal(other.Time) {
+		return p.Time.After(other.Time)
+	}
+
+	return strings.Compare(p.UserID, other.UserID) > 0
+}
+
+// NewUserChange reports the current version of user as the change of its
+// last write.
+func NewUserChange(user User) UserChange {
+	changeType := UserUpdated
+	switch {
+	case user.IsDeleted():
+		changeType = UserDeleted
+	case user.CreatedAt.Equal(user.UpdatedAt):
+		changeType = UserCreated
+	}
+
+	return UserChange{
+		Type:     changeType,
+		User:     user,
+		Position: UserChangePosition{Time: user.UpdatedAt, UserID: user.ID.String()},
+	}
+}
+
+// NewUserRemoval reports that user was removed for good at removeTime.
+func NewUserRemoval(user User, removeTime time.Time) UserChange {
+	return UserChange{
+		Type:     UserDeleted,
+		User:     user,
+		Position: UserChangePosition{Time: removeTime, UserID: user.ID.String()},
+	}
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shotokan/firebase-training/internal/common/errors"
+)
+
+var (
+	ErrUnsupportedFilterCombination = errors.NewIncorrectInputError(
+		"filters on email and creation date can't be combined, and the page must be sorted by the filtered field",
+		"unsupported-filter-combination",
+	)
+	ErrMissingCompositeIndex = errors.NewIncorrectInputError(
+		"this combination of filters and sort is not indexed",
+		"missing-composite-index",
+	)
+)
+
+type UserSortField string
+
+const (
+	// UserSortByID is the default order, it is stable but meaningless for people.
+	UserSortByID        UserSortField = "id"
+	UserSortByName      UserSortField = "name"
+	UserSortByEmail     UserSortField = "email"
+	UserSortByCreatedAt UserSortField = "createdAt"
+)
+
+type UserSort struct {
+	// Field is empty when the caller has no preference.
+	Field      UserSortField
+	Descending bool
+}
+
+// UserFilter keeps users matching all of its non-zero fields.
+type UserFilter struct {
+	// EmailPrefix is matched case-insensitively.
+	EmailPrefix string
+	Role        string
+	// CreatedFrom is inclusive.
+	CreatedFrom *time.Time
+	// CreatedTo is exclusive.
+	CreatedTo *time.Time
+	// IncludeDeleted also keeps soft-deleted users.
+	IncludeDeleted bool
+}
+
+// UserCursor points at the last user of a page, the next page starts right
+// after it. Cursors do not depend on offsets, so pages stay stable when users
+// are added concurrently.
+type UserCursor struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name,omitempty"`
+	NormalizedEmail string    `json:"email,omitempty"`
+	CreatedAt       time.Time `json:"createdAt,omitempty"`
+}
+
+func NewUserCursor(user User) UserCursor {
+	return UserCursor{
+		ID:              user.ID.String(),
+		Name:            user.Name,
+		NormalizedEmail: NormalizedEmail(user.Email),
+		CreatedAt:       user.CreatedAt,
+	}
+}
+
+// UserQuery selects a page of users. Users with the same value of the sort
+// field are ordered by ID.
+type UserQuery struct {
+	Filter UserFilter
+	Sort   UserSort
+	Limit  int
+	// After is nil for the first page.
+	After *UserCursor
+}
+
+type UserPage struct {
+	Users []User
+	// Next is nil when there are no more users.
+	Next *UserCursor
+}
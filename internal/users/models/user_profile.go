@@ -0,0 +1,91 @@
+package models
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	// Timezones are validated against the embedded database, not the one of
+	// the host, which may be missing from containers.
+	_ "time/tzdata"
+	"unicode/utf8"
+
+	"github.com/shotokan/firebase-training/internal/common/errors"
+	"golang.org/x/text/language"
+)
+
+var (
+	ErrInvalidPhone     = errors.NewIncorrectInputError("phone must be an E.164 number, like +14155550123", "invalid-phone")
+	ErrInvalidLocale    = errors.NewIncorrectInputError("locale must be a BCP 47 language tag, like en-US", "invalid-locale")
+	ErrInvalidTimezone  = errors.NewIncorrectInputError("timezone must be an IANA time zone name, like Europe/Madrid", "invalid-timezone")
+	ErrInvalidAvatarURL = errors.NewIncorrectInputError("avatar must be an absolute http or https URL", "invalid-avatar-url")
+	ErrBioTooLong       = errors.NewIncorrectInputError("bio is too long", "bio-too-long")
+)
+
+const (
+	maxAvatarURLLength = 2048
+	maxBioLength       = 500
+)
+
+var e164Phone = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// UserProfile holds the optional personal details of a user. Empty fields
+// are not set.
+type UserProfile struct {
+	Phone string
+	// Locale is a canonical BCP 47 language tag.
+	Locale string
+	// Timezone is an IANA time zone name.
+	Timezone  string
+	AvatarURL string
+	Bio       string
+}
+
+// NewUserProfile validates a profile, failing with an incorrect input error
+// when any of the fields is invalid. The locale is canonicalized, so en-us
+// becomes en-US.
+func NewUserProfile(phone string, locale string, timezone string, avatarURL string, bio string) (UserProfile, error) {
+	if phone != "" && !e164Phone.MatchString(phone) {
+		return UserProfile{}, ErrInvalidPhone
+	}
+
+	if locale != "" {
+		tag, err := language.Parse(locale)
+		if err != nil {
+			return UserProfile{}, ErrInvalidLocale
+		}
+		locale = tag.String()
+	}
+
+	if timezone != "" {
+		// Local is the timezone of the server, not a name.
+		if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" {
+			return UserProfile{}, ErrInvalidTimezone
+		}
+	}
+
+	if avatarURL != "" {
+		if len(avatarURL) > maxAvatarURLLength {
+			return UserProfile{}, ErrInvalidAvatarURL
+		}
+		u, err := url.Parse(avatarURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return UserProfile{}, ErrInvalidAvatarURL
+		}
+	}
+
+	if utf8.RuneCountInString(bio) > maxBioLength {
+		return UserProfile{}, ErrBioTooLong
+	}
+	if strings.TrimSpace(bio) == "" {
+		bio = ""
+	}
+
+	return UserProfile{
+		Phone:     phone,
+		Locale:    locale,
+		Timezone:  timezone,
+		AvatarURL: avatarURL,
+		Bio:       bio,
+	}, nil
+}
@@ -0,0 +1,86 @@
+package models_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shotokan/firebase-training/internal/users/models"
+)
+
+func TestNewUserProfile(t *testing.T) {
+	tests := []struct {
+		name      string
+		phone     string
+		locale    string
+		timezone  string
+		avatarURL string
+		bio       string
+		want      models.UserProfile
+		wantSlug  string
+	}{
+		{name: "empty profile"},
+		{
+			name:      "full profile",
+			phone:     "+14155550123",
+			locale:    "en-GB",
+			timezone:  "Europe/London",
+			avatarURL: "https://example.com/amy.png",
+			bio:       "Hi, I'm Amy",
+			want: models.UserProfile{
+				Phone:     "+14155550123",
+				Locale:    "en-GB",
+				Timezone:  "Europe/London",
+				AvatarURL: "https://example.com/amy.png",
+				Bio:       "Hi, I'm Amy",
+			},
+		},
+
+		{name: "shortest phone", phone: "+12", want: models.UserProfile{Phone: "+12"}},
+		{name: "longest phone", phone: "+123456789012345", want: models.UserProfile{Phone: "+123456789012345"}},
+		{name: "phone without plus", phone: "14155550123", wantSlug: "invalid-phone"},
+		{name: "phone starting with zero", phone: "+04155550123", wantSlug: "invalid-phone"},
+		{name: "phone too long", phone: "+1234567890123456", wantSlug: "invalid-phone"},
+		{name: "phone with spaces", phone: "+1 415 555 0123", wantSlug: "invalid-phone"},
+		{name: "phone with dashes", phone: "+1-415-555-0123", wantSlug: "invalid-phone"},
+
+		{name: "locale is canonicalized", locale: "en-us", want: models.UserProfile{Locale: "en-US"}},
+		{name: "language only locale", locale: "es", want: models.UserProfile{Locale: "es"}},
+		{name: "locale with script", locale: "zh-Hant-TW", want: models.UserProfile{Locale: "zh-Hant-TW"}},
+		{name: "locale with underscore is canonicalized", locale: "en_US", want: models.UserProfile{Locale: "en-US"}},
+		{name: "malformed locale", locale: "english!", wantSlug: "invalid-locale"},
+
+		{name: "IANA timezone", timezone: "America/Argentina/Buenos_Aires", want: models.UserProfile{Timezone: "America/Argentina/Buenos_Aires"}},
+		{name: "UTC timezone", timezone: "UTC", want: models.UserProfile{Timezone: "UTC"}},
+		{name: "Local timezone", timezone: "Local", wantSlug: "invalid-timezone"},
+		{name: "unknown timezone", timezone: "Mars/Olympus_Mons", wantSlug: "invalid-timezone"},
+		{name: "offset timezone", timezone: "+02:00", wantSlug: "invalid-timezone"},
+
+		{name: "http avatar", avatarURL: "http://example.com/amy.png", want: models.UserProfile{AvatarURL: "http://example.com/amy.png"}},
+		{name: "avatar with another scheme", avatarURL: "ftp://example.com/amy.png", wantSlug: "invalid-avatar-url"},
+		{name: "javascript avatar", avatarURL: "javascript:alert(1)", wantSlug: "invalid-avatar-url"},
+		{name: "relative avatar", avatarURL: "/amy.png", wantSlug: "invalid-avatar-url"},
+		{name: "avatar without host", avatarURL: "https:///amy.png", wantSlug: "invalid-avatar-url"},
+		{name: "avatar too long", avatarURL: "https://example.com/" + strings.Repeat("a", 2048), wantSlug: "invalid-avatar-url"},
+
+		{name: "longest bio", bio: strings.Repeat("ñ", 500), want: models.UserProfile{Bio: strings.Repeat("ñ", 500)}},
+		{name: "blank bio is not set", bio: "  \n", want: models.UserProfile{}},
+		{name: "bio too long", bio: strings.Repeat("a", 501), wantSlug: "bio-too-long"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, err := models.NewUserProfile(tt.phone, tt.locale, tt.timezone, tt.avatarURL, tt.bio)
+			if tt.wantSlug == "" {
+				if err != nil {
+					t.Fatalf("NewUserProfile() = %v, want nil", err)
+				}
+				if profile != tt.want {
+					t.Errorf("NewUserProfile() = %+v, want %+v", profile, tt.want)
+				}
+				return
+			}
+
+			expectIncorrectInput(t, err, tt.wantSlug)
+		})
+	}
+}
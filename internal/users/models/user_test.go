@@ -0,0 +1,127 @@
+package models_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	commonerrors "github.com/shotokan/firebase-training/internal/common/errors"
+	"github.com/shotokan/firebase-training/internal/users/models"
+)
+
+func TestNewUser(t *testing.T) {
+	tests := []struct {
+		name         string
+		userName     string
+		email        string
+		role         string
+		passwordHash string
+		wantSlug     string
+	}{
+		{name: "valid user", userName: "Amy", email: "amy@example.com", role: models.RoleUser, passwordHash: "hash"},
+		{name: "valid trainer", userName: "Amy", email: "amy@example.com", role: models.RoleTrainer, passwordHash: "hash"},
+		{name: "valid admin", userName: "Amy", email: "amy@example.com", role: models.RoleAdmin, passwordHash: "hash"},
+		{name: "longest name", userName: strings.Repeat("é", 100), email: "amy@example.com", role: models.RoleUser, passwordHash: "hash"},
+
+		{name: "empty name", userName: "", email: "amy@example.com", role: models.RoleUser, passwordHash: "hash", wantSlug: "empty-name"},
+		{name: "blank name", userName: " \t", email: "amy@example.com", role: models.RoleUser, passwordHash: "hash", wantSlug: "empty-name"},
+		{name: "name too long", userName: strings.Repeat("a", 101), email: "amy@example.com", role: models.RoleUser, passwordHash: "hash", wantSlug: "name-too-long"},
+
+		{name: "email without at", userName: "Amy", email: "amy.example.com", role: models.RoleUser, passwordHash: "hash", wantSlug: "invalid-email"},
+		{name: "empty email", userName: "Amy", email: "", role: models.RoleUser, passwordHash: "hash", wantSlug: "invalid-email"},
+		{name: "email with a display name", userName: "Amy", email: "Amy <amy@example.com>", role: models.RoleUser, passwordHash: "hash", wantSlug: "invalid-email"},
+		{name: "email with angle brackets", userName: "Amy", email: "<amy@example.com>", role: models.RoleUser, passwordHash: "hash", wantSlug: "invalid-email"},
+		{name: "email with embedded spaces", userName: "Amy", email: "amy smith@example.com", role: models.RoleUser, passwordHash: "hash", wantSlug: "invalid-email"},
+		{name: "email with surrounding spaces", userName: "Amy", email: " amy@example.com ", role: models.RoleUser, passwordHash: "hash", wantSlug: "invalid-email"},
+		{name: "email too long", userName: "Amy", email: strings.Repeat("a", 64) + "@" + strings.Repeat("b", 186) + ".com", role: models.RoleUser, passwordHash: "hash", wantSlug: "invalid-email"},
+
+		{name: "empty role", userName: "Amy", email: "amy@example.com", role: "", passwordHash: "hash", wantSlug: "invalid-role"},
+		{name: "unknown role", userName: "Amy", email: "amy@example.com", role: "owner", passwordHash: "hash", wantSlug: "invalid-role"},
+		{name: "role in another case", userName: "Amy", email: "amy@example.com", role: "Admin", passwordHash: "hash", wantSlug: "invalid-role"},
+
+		{name: "missing password hash", userName: "Amy", email: "amy@example.com", role: models.RoleUser, passwordHash: "", wantSlug: "missing-password"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := uuid.New()
+			user, err := models.NewUser(id, tt.userName, tt.email, tt.role, tt.passwordHash)
+			if tt.wantSlug == "" {
+				if err != nil {
+					t.Fatalf("NewUser() = %v, want nil", err)
+				}
+				if user.ID != id || user.Name != tt.userName || user.Email != tt.email || user.Role != tt.role || user.PasswordHash != tt.passwordHash {
+					t.Errorf("NewUser() = %+v, want the given fields", user)
+				}
+				return
+			}
+
+			expectIncorrectInput(t, err, tt.wantSlug)
+		})
+	}
+}
+
+func TestUserChangesKeepInvalidValuesOut(t *testing.T) {
+	user, err := models.NewUser(uuid.New(), "Amy", "amy@example.com", models.RoleUser, "hash")
+	if err != nil {
+		t.Fatalf("NewUser() = %v", err)
+	}
+
+	expectIncorrectInput(t, user.ChangeName(""), "empty-name")
+	expectIncorrectInput(t, user.ChangeEmail("Amy <amy2@example.com>"), "invalid-email")
+	expectIncorrectInput(t, user.ChangeRole("root"), "invalid-role")
+	expectIncorrectInput(t, user.ChangePasswordHash(""), "missing-password")
+
+	if user.Name != "Amy" || user.Email != "amy@example.com" || user.Role != models.RoleUser || user.PasswordHash != "hash" {
+		t.Errorf("got %+v, want the user unchanged", user)
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantSlug string
+	}{
+		{name: "letters and digits", password: "passw0rd"},
+		{name: "letters and symbols", password: "pass-word"},
+		{name: "unicode letters and digits", password: "contraseña1"},
+		{name: "longest password", password: strings.Repeat("a", 71) + "1"},
+
+		{name: "empty", password: "", wantSlug: "missing-password"},
+		{name: "too short", password: "pa55wd", wantSlug: "password-too-short"},
+		{name: "seven characters", password: "passw0r", wantSlug: "password-too-short"},
+		{name: "too long", password: strings.Repeat("a", 72) + "1", wantSlug: "password-too-long"},
+		{name: "too long in bytes", password: strings.Repeat("é", 36) + "1", wantSlug: "password-too-long"},
+		{name: "letters only", password: "password", wantSlug: "password-too-simple"},
+		{name: "digits only", password: "12345678", wantSlug: "password-too-simple"},
+		{name: "symbols and digits only", password: "1234-5678", wantSlug: "password-too-simple"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := models.ValidatePassword(tt.password)
+			if tt.wantSlug == "" {
+				if err != nil {
+					t.Fatalf("ValidatePassword() = %v, want nil", err)
+				}
+				return
+			}
+
+			expectIncorrectInput(t, err, tt.wantSlug)
+		})
+	}
+}
+
+func expectIncorrectInput(t *testing.T, err error, wantSlug string) {
+	t.Helper()
+
+	var slugError commonerrors.SlugError
+	if !errors.As(err, &slugError) {
+		t.Fatalf("got %v, want a slug error", err)
+	}
+	if slugError.Slug() != wantSlug || slugError.ErrorType() != commonerrors.ErrorTypeIncorrectInput {
+		t.Errorf("got %v (%v), want an incorrect input %s error", slugError.Slug(), slugError.ErrorType(), wantSlug)
+	}
+}
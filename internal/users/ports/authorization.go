@@ -0,0 +1,188 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/shotokan/firebase-training/internal/common"
+	commonerrors "github.com/shotokan/firebase-training/internal/common/errors"
+	"github.com/shotokan/firebase-training/internal/users/models"
+	"github.com/sirupsen/logrus"
+)
+
+// UserAction is something done to users, allowed or denied by a UserPolicy.
+type UserAction string
+
+const (
+	UserActionList   UserAction = "list"
+	UserActionRead   UserAction = "read"
+	UserActionCreate UserAction = "create"
+	UserActionUpdate UserAction = "update"
+	UserActionDelete UserAction = "delete"
+	UserActionExport UserAction = "export"
+	UserActionWatch  UserAction = "watch"
+	// UserActionReadDeleted is reading soft-deleted users, on top of
+	// listing or reading them.
+	UserActionReadDeleted UserAction = "read-deleted"
+	// UserActionChangeEmail, UserActionChangeRole and UserActionChangeOwner
+	// are updates of the email, the role and the auth subject, on top of
+	// UserActionUpdate.
+	UserActionChangeEmail UserAction = "change-email"
+	UserActionChangeRole  UserAction = "change-role"
+	UserActionChangeOwner UserAction = "change-owner"
+)
+
+// UserPolicy lists the roles allowed to do an action.
+type UserPolicy struct {
+	// Roles may do the action to any user.
+	Roles []string
+	// OwnerRoles may only do the action to their own user, the one whose
+	// AuthSubject is the subject of their token.
+	OwnerRoles []string
+	// Denied is returned to everyone else.
+	Denied commonerrors.SlugError
+}
+
+// UserPolicies maps every action to its policy, actions without one are
+// denied.
+type UserPolicies map[UserAction]UserPolicy
+
+// DefaultUserPolicies give admins full access, let trainers read and update
+// everyone but change only their own email, and let users read and update
+// only themselves.
+var DefaultUserPolicies = UserPolicies{
+	UserActionList: {
+		Roles:  []string{models.RoleAdmin, models.RoleTrainer},
+		Denied: commonerrors.NewForbiddenError("only admins and trainers can list users", "list-users-not-allowed"),
+	},
+	UserActionRead: {
+		Roles:      []string{models.RoleAdmin, models.RoleTrainer},
+		OwnerRoles: []string{models.RoleUser},
+		Denied:     commonerrors.NewForbiddenError("users can only read themselves", "read-user-not-allowed"),
+	},
+	UserActionReadDeleted: {
+		Roles:  []string{models.RoleAdmin},
+		Denied: commonerrors.NewForbiddenError("only admins can read deleted users", "read-deleted-users-not-allowed"),
+	},
+	UserActionCreate: {
+		Roles:  []string{models.RoleAdmin},
+		Denied: commonerrors.NewForbiddenError("only admins can create users", "create-user-not-allowed"),
+	},
+	UserActionUpdate: {
+		Roles:      []string{models.RoleAdmin, models.RoleTrainer},
+		OwnerRoles: []string{models.RoleUser},
+		Denied:     commonerrors.NewForbiddenError("users can only update themselves", "update-user-not-allowed"),
+	},
+	UserActionChangeEmail: {
+		Roles:      []string{models.RoleAdmin},
+		OwnerRoles: []string{models.RoleTrainer, models.RoleUser},
+		Denied:     commonerrors.NewForbiddenError("only admins can change the email of other users", "change-email-not-allowed"),
+	},
+	UserActionChangeRole: {
+		Roles:  []string{models.RoleAdmin},
+		Denied: commonerrors.NewForbiddenError("only admins can change roles", "change-role-not-allowed"),
+	},
+	UserActionChangeOwner: {
+		Roles:  []string{models.RoleAdmin},
+		Denied: commonerrors.NewForbiddenError("only admins can change who owns users", "change-owner-not-allowed"),
+	},
+	UserActionDelete: {
+		Roles:  []string{models.RoleAdmin},
+		Denied: commonerrors.NewForbiddenError("only admins can delete or restore users", "delete-user-not-allowed"),
+	},
+	UserActionExport: {
+		Roles:  []string{models.RoleAdmin},
+		Denied: commonerrors.NewForbiddenError("only admins can export users", "export-not-allowed"),
+	},
+	UserActionWatch: {
+		Roles:  []string{models.RoleAdmin},
+		Denied: commonerrors.NewForbiddenError("only admins can watch users", "watch-not-allowed"),
+	},
+}
+
+var errActionNotAllowed = commonerrors.NewForbiddenError("action is not allowed", "action-not-allowed")
+
+// Allows reports whether principal may do action to the target user, nil for
+// actions on many users. Owners are only known for a single target.
+func (p UserPolicy) Allows(principal common.User, target *models.User) bool {
+	if hasRole(p.Roles, principal.Role) {
+		return true
+	}
+
+	return isOwner(principal, target) && hasRole(p.OwnerRoles, principal.Role)
+}
+
+// Authorize fails with the Denied error of the policy of action unless it
+// allows principal to do it, and logs the decision either way.
+func (p UserPolicies) Authorize(principal common.User, action UserAction, target *models.User) error {
+	policy, ok := p[action]
+	allowed := ok && policy.Allows(principal, target)
+
+	log := logrus.WithFields(logrus.Fields{
+		"principal": principal.UUID,
+		"role":      principal.Role,
+		"action":    action,
+		"allowed":   allowed,
+	})
+	if target != nil {
+		log = log.WithField("target", target.ID)
+	}
+	log.Info("Authorization decision")
+
+	if allowed {
+		return nil
+	}
+	if !ok {
+		return errActionNotAllowed
+	}
+
+	return policy.Denied
+}
+
+// authorize checks the policy of action for the user of ctx. Actions on a
+// single user are authorized once it is loaded, its owner is stored with it.
+func (h HttpServer) authorize(ctx context.Context, action UserAction, target *models.User) error {
+	principal, err := common.UserFromCtx(ctx)
+	if err != nil {
+		return err
+	}
+
+	return h.policies.Authorize(principal, action, target)
+}
+
+// authorizeChanges checks the policies of the fields changed from before to
+// after, which only some roles may change.
+func (h HttpServer) authorizeChanges(ctx context.Context, before models.User, after models.User) error {
+	if after.Email != before.Email {
+		if err := h.authorize(ctx, UserActionChangeEmail, &before); err != nil {
+			return err
+		}
+	}
+	if after.Role != before.Role {
+		if err := h.authorize(ctx, UserActionChangeRole, &before); err != nil {
+			return err
+		}
+	}
+	if after.AuthSubject != before.AuthSubject {
+		if err := h.authorize(ctx, UserActionChangeOwner, &before); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isOwner reports whether target is the user of principal. Users without an
+// AuthSubject have no owner.
+func isOwner(principal common.User, target *models.User) bool {
+	return target != nil && target.AuthSubject != "" && target.AuthSubject == principal.UUID
+}
+
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,102 @@
+package ports_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shotokan/firebase-training/internal/common"
+	commonerrors "github.com/shotokan/firebase-training/internal/common/errors"
+	"github.com/shotokan/firebase-training/internal/users/models"
+	"github.com/shotokan/firebase-training/internal/users/ports"
+)
+
+func TestDefaultUserPoliciesAuthorize(t *testing.T) {
+	admin := common.User{UUID: "admin-subject", Role: models.RoleAdmin}
+	trainer := common.User{UUID: "trainer-subject", Role: models.RoleTrainer}
+	user := common.User{UUID: "user-subject", Role: models.RoleUser}
+
+	own := func(principal common.User) *models.User {
+		return &models.User{ID: uuid.New(), AuthSubject: principal.UUID}
+	}
+	other := &models.User{ID: uuid.New(), AuthSubject: "other-subject"}
+	unowned := &models.User{ID: uuid.New()}
+
+	tests := []struct {
+		name      string
+		principal common.User
+		action    ports.UserAction
+		target    *models.User
+		wantSlug  string
+	}{
+		{name: "admin lists users", principal: admin, action: ports.UserActionList},
+		{name: "trainer lists users", principal: trainer, action: ports.UserActionList},
+		{name: "user lists users", principal: user, action: ports.UserActionList, wantSlug: "list-users-not-allowed"},
+
+		{name: "admin reads another user", principal: admin, action: ports.UserActionRead, target: other},
+		{name: "trainer reads another user", principal: trainer, action: ports.UserActionRead, target: other},
+		{name: "user reads their own user", principal: user, action: ports.UserActionRead, target: own(user)},
+		{name: "user reads another user", principal: user, action: ports.UserActionRead, target: other, wantSlug: "read-user-not-allowed"},
+		{name: "user reads an unowned user", principal: common.User{Role: models.RoleUser}, action: ports.UserActionRead, target: unowned, wantSlug: "read-user-not-allowed"},
+
+		{name: "admin reads deleted users", principal: admin, action: ports.UserActionReadDeleted},
+		{name: "trainer reads deleted users", principal: trainer, action: ports.UserActionReadDeleted, wantSlug: "read-deleted-users-not-allowed"},
+		{name: "user reads their own deleted user", principal: user, action: ports.UserActionReadDeleted, target: own(user), wantSlug: "read-deleted-users-not-allowed"},
+
+		{name: "admin creates users", principal: admin, action: ports.UserActionCreate},
+		{name: "trainer creates users", principal: trainer, action: ports.UserActionCreate, wantSlug: "create-user-not-allowed"},
+		{name: "user creates users", principal: user, action: ports.UserActionCreate, wantSlug: "create-user-not-allowed"},
+
+		{name: "admin updates another user", principal: admin, action: ports.UserActionUpdate, target: other},
+		{name: "trainer updates another user", principal: trainer, action: ports.UserActionUpdate, target: other},
+		{name: "user updates their own user", principal: user, action: ports.UserActionUpdate, target: own(user)},
+		{name: "user updates another user", principal: user, action: ports.UserActionUpdate, target: other, wantSlug: "update-user-not-allowed"},
+
+		{name: "admin changes the email of another user", principal: admin, action: ports.UserActionChangeEmail, target: other},
+		{name: "trainer changes their own email", principal: trainer, action: ports.UserActionChangeEmail, target: own(trainer)},
+		{name: "trainer changes the email of another user", principal: trainer, action: ports.UserActionChangeEmail, target: other, wantSlug: "change-email-not-allowed"},
+		{name: "user changes their own email", principal: user, action: ports.UserActionChangeEmail, target: own(user)},
+		{name: "user changes the email of another user", principal: user, action: ports.UserActionChangeEmail, target: other, wantSlug: "change-email-not-allowed"},
+
+		{name: "admin changes the role of another user", principal: admin, action: ports.UserActionChangeRole, target: other},
+		{name: "admin changes their own role", principal: admin, action: ports.UserActionChangeRole, target: own(admin)},
+		{name: "trainer changes the role of another user", principal: trainer, action: ports.UserActionChangeRole, target: other, wantSlug: "change-role-not-allowed"},
+		{name: "trainer changes their own role", principal: trainer, action: ports.UserActionChangeRole, target: own(trainer), wantSlug: "change-role-not-allowed"},
+		{name: "user changes their own role", principal: user, action: ports.UserActionChangeRole, target: own(user), wantSlug: "change-role-not-allowed"},
+
+		{name: "admin changes the owner of another user", principal: admin, action: ports.UserActionChangeOwner, target: other},
+		{name: "user changes their own owner", principal: user, action: ports.UserActionChangeOwner, target: own(user), wantSlug: "change-owner-not-allowed"},
+
+		{name: "admin deletes another user", principal: admin, action: ports.UserActionDelete, target: other},
+		{name: "trainer deletes another user", principal: trainer, action: ports.UserActionDelete, target: other, wantSlug: "delete-user-not-allowed"},
+		{name: "user deletes their own user", principal: user, action: ports.UserActionDelete, target: own(user), wantSlug: "delete-user-not-allowed"},
+
+		{name: "admin exports users", principal: admin, action: ports.UserActionExport},
+		{name: "trainer exports users", principal: trainer, action: ports.UserActionExport, wantSlug: "export-not-allowed"},
+		{name: "admin watches users", principal: admin, action: ports.UserActionWatch},
+		{name: "user watches users", principal: user, action: ports.UserActionWatch, wantSlug: "watch-not-allowed"},
+
+		{name: "unknown role", principal: common.User{UUID: "guest-subject", Role: "guest"}, action: ports.UserActionRead, target: other, wantSlug: "read-user-not-allowed"},
+		{name: "action without a policy", principal: admin, action: "impersonate", wantSlug: "action-not-allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ports.DefaultUserPolicies.Authorize(tt.principal, tt.action, tt.target)
+			if tt.wantSlug == "" {
+				if err != nil {
+					t.Fatalf("Authorize() = %v, want nil", err)
+				}
+				return
+			}
+
+			var slugError commonerrors.SlugError
+			if !errors.As(err, &slugError) {
+				t.Fatalf("Authorize() = %v, want a slug error", err)
+			}
+			if slugError.Slug() != tt.wantSlug || slugError.ErrorType() != commonerrors.ErrorTypeForbidden {
+				t.Errorf("Authorize() = %v (%v), want a forbidden %s error", slugError.Slug(), slugError.ErrorType(), tt.wantSlug)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package ports
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	commonerrors "github.com/shotokan/firebase-training/internal/common/errors"
+)
+
+// CustomMethodRouter adds support for custom methods, like
+// POST /users/{userId}:restore, to an EchoRouter.
+//
+// Echo takes every ':' as the start of a path parameter. Colons of static
+// segments, like /users:batchCreate, are escaped. Custom methods following a
+// parameter, like /users/:userId:restore, can't be routed by echo at all, so
+// they share the route of the parameter, /users/:userId, and a dispatcher
+// strips the method from the parameter value before calling the handler.
+type CustomMethodRouter struct {
+	EchoRouter
+
+	dispatchers map[string]*customMethodDispatcher
+}
+
+func NewCustomMethodRouter(router EchoRouter) *CustomMethodRouter {
+	return &CustomMethodRouter{
+		EchoRouter:  router,
+		dispatchers: map[string]*customMethodDispatcher{},
+	}
+}
+
+func (r *CustomMethodRouter) DELETE(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	return r.add(http.MethodDelete, r.EchoRouter.DELETE, path, h, m)
+}
+
+func (r *CustomMethodRouter) GET(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	return r.add(http.MethodGet, r.EchoRouter.GET, path, h, m)
+}
+
+func (r *CustomMethodRouter) PATCH(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	return r.add(http.MethodPatch, r.EchoRouter.PATCH, path, h, m)
+}
+
+func (r *CustomMethodRouter) POST(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	return r.add(http.MethodPost, r.EchoRouter.POST, path, h, m)
+}
+
+func (r *CustomMethodRouter) PUT(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	return r.add(http.MethodPut, r.EchoRouter.PUT, path, h, m)
+}
+
+type routeFunc func(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+
+func (r *CustomMethodRouter) add(
+	method string,
+	route routeFunc,
+	path string,
+	h echo.HandlerFunc,
+	m []echo.MiddlewareFunc,
+) *echo.Route {
+	lastSlash := strings.LastIndex(path, "/")
+	segment := path[lastSlash+1:]
+
+	colon := strings.LastIndex(segment, ":")
+	if colon <= 0 {
+		if strings.HasPrefix(segment, ":") {
+			// A plain parameter, custom methods may share its route.
+			return r.dispatcher(method, path, segment[1:]).setDefault(route, h, m)
+		}
+		return route(path, h, m...)
+	}
+
+	if !strings.HasPrefix(segment, ":") {
+		return route(path[:lastSlash+1]+escapeColons(segment), h, m...)
+	}
+
+	paramPath := path[:lastSlash+1] + segment[:colon]
+	customMethod := segment[colon+1:]
+
+	return r.dispatcher(method, paramPath, segment[1:colon]).addCustomMethod(route, customMethod, h, m)
+}
+
+func (r *CustomMethodRouter) dispatcher(method, path, param string) *customMethodDispatcher {
+	key := method + " " + path
+	if d, ok := r.dispatchers[key]; ok {
+		return d
+	}
+
+	d := &customMethodDispatcher{
+		path:          path,
+		param:         param,
+		customMethods: map[string]echo.HandlerFunc{},
+	}
+	r.dispatchers[key] = d
+
+	return d
+}
+
+func escapeColons(segment string) string {
+	return strings.ReplaceAll(segment, ":", `\:`)
+}
+
+// customMethodDispatcher serves a route ending with a parameter, for the
+// plain route and all of its custom methods.
+type customMethodDispatcher struct {
+	path  string
+	param string
+
+	defaultHandler echo.HandlerFunc
+	customMethods  map[string]echo.HandlerFunc
+}
+
+func (d *customMethodDispatcher) setDefault(route routeFunc, h echo.HandlerFunc, m []echo.MiddlewareFunc) *echo.Route {
+	d.defaultHandler = applyMiddleware(h, m)
+
+	return route(d.path, d.serve)
+}
+
+func (d *customMethodDispatcher) addCustomMethod(
+	route routeFunc,
+	customMethod string,
+	h echo.HandlerFunc,
+	m []echo.MiddlewareFunc,
+) *echo.Route {
+	d.customMethods[customMethod] = applyMiddleware(h, m)
+
+	return route(d.path, d.serve)
+}
+
+func (d *customMethodDispatcher) serve(ctx echo.Context) error {
+	value := ctx.Param(d.param)
+
+	if colon := strings.LastIndex(value, ":"); colon >= 0 {
+		customMethod := value[colon+1:]
+		h, ok := d.customMethods[customMethod]
+		if !ok {
+			return commonerrors.NotFound(
+				"custom-method-not-found",
+				fmt.Errorf("%s %s has no custom method %q", ctx.Request().Method, d.path, customMethod),
+			)
+		}
+
+		values := ctx.ParamValues()
+		for i, name := range ctx.ParamNames() {
+			if name == d.param {
+				values[i] = value[:colon]
+			}
+		}
+		ctx.SetParamValues(values...)
+
+		return h(ctx)
+	}
+
+	if d.defaultHandler == nil {
+		return commonerrors.MethodNotAllowed(
+			"method-not-allowed",
+			fmt.Errorf("%s %s is only served with a custom method", ctx.Request().Method, d.path),
+		)
+	}
+
+	return d.defaultHandler(ctx)
+}
+
+func applyMiddleware(h echo.HandlerFunc, m []echo.MiddlewareFunc) echo.HandlerFunc {
+	for i := len(m) - 1; i >= 0; i-- {
+		h = m[i](h)
+	}
+
+	return h
+}
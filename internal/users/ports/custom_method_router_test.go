@@ -0,0 +1,105 @@
+package ports_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/shotokan/firebase-training/internal/users/ports"
+)
+
+func TestCustomMethodRouter(t *testing.T) {
+	e := echo.New()
+	router := ports.NewCustomMethodRouter(e)
+
+	// The routes of RegisterHandlers, every handler answers with its name and
+	// the userId it got.
+	routes := []struct {
+		method string
+		path   string
+		name   string
+	}{
+		{http.MethodGet, "/users", "GetUsers"},
+		{http.MethodPost, "/users", "CreateUser"},
+		{http.MethodDelete, "/users/:userId", "DeleteUser"},
+		{http.MethodGet, "/users/:userId", "GetUserById"},
+		{http.MethodPatch, "/users/:userId", "PatchUser"},
+		{http.MethodPut, "/users/:userId", "ReplaceUser"},
+		{http.MethodGet, "/users/:userId/profile", "GetUserProfile"},
+		{http.MethodPost, "/users/:userId:restore", "RestoreUser"},
+		{http.MethodPost, "/users:batchCreate", "BatchCreateUsers"},
+		{http.MethodPost, "/users:batchGet", "BatchGetUsers"},
+		{http.MethodGet, "/users:export", "ExportUsers"},
+		{http.MethodGet, "/users:watch", "WatchUsers"},
+	}
+	for _, route := range routes {
+		name := route.name
+		handler := func(c echo.Context) error {
+			return c.String(http.StatusOK, name+" "+c.Param("userId"))
+		}
+		switch route.method {
+		case http.MethodGet:
+			router.GET(route.path, handler)
+		case http.MethodPost:
+			router.POST(route.path, handler)
+		case http.MethodPatch:
+			router.PATCH(route.path, handler)
+		case http.MethodPut:
+			router.PUT(route.path, handler)
+		case http.MethodDelete:
+			router.DELETE(route.path, handler)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		want       string
+		wantStatus int
+		wantSlug   string
+	}{
+		{name: "collection", method: http.MethodGet, path: "/users", want: "GetUsers "},
+		{name: "batch create", method: http.MethodPost, path: "/users:batchCreate", want: "BatchCreateUsers "},
+		{name: "batch get", method: http.MethodPost, path: "/users:batchGet", want: "BatchGetUsers "},
+		{name: "export", method: http.MethodGet, path: "/users:export", want: "ExportUsers "},
+		{name: "watch", method: http.MethodGet, path: "/users:watch", want: "WatchUsers "},
+		{name: "user", method: http.MethodGet, path: "/users/42", want: "GetUserById 42"},
+		{name: "user patch", method: http.MethodPatch, path: "/users/42", want: "PatchUser 42"},
+		{name: "user delete", method: http.MethodDelete, path: "/users/42", want: "DeleteUser 42"},
+		{name: "restore", method: http.MethodPost, path: "/users/42:restore", want: "RestoreUser 42"},
+		{name: "user profile", method: http.MethodGet, path: "/users/42/profile", want: "GetUserProfile 42"},
+
+		{name: "unknown custom method", method: http.MethodPost, path: "/users/42:purge", wantStatus: http.StatusNotFound, wantSlug: "custom-method-not-found"},
+		{name: "custom method of another http method", method: http.MethodGet, path: "/users/42:restore", wantStatus: http.StatusNotFound, wantSlug: "custom-method-not-found"},
+		{name: "only a custom method is routed", method: http.MethodPost, path: "/users/42", wantStatus: http.StatusMethodNotAllowed, wantSlug: "method-not-allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if tt.wantSlug == "" {
+				if rec.Code != http.StatusOK || rec.Body.String() != tt.want {
+					t.Errorf("got %d %q, want %q", rec.Code, rec.Body, tt.want)
+				}
+				return
+			}
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			var resp ports.Error
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decoding error: %v", err)
+			}
+			if resp.Slug != tt.wantSlug {
+				t.Errorf("got slug %q, want %q", resp.Slug, tt.wantSlug)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package ports
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	commonerrors "github.com/shotokan/firebase-training/internal/common/errors"
+	"github.com/shotokan/firebase-training/internal/users/models"
+)
+
+// echo doesn't define a constant for the ETag header.
+const headerETag = "ETag"
+
+var errInvalidIfMatch = commonerrors.NewIncorrectInputError(
+	"If-Match must be * or a single entity tag",
+	"invalid-if-match",
+)
+
+// userETag is the strong entity tag of the version of the user, derived from
+// its update time.
+func userETag(user models.User) string {
+	return `"` + strconv.FormatInt(user.UpdateTime.UnixNano(), 36) + `"`
+}
+
+// ifMatchPrecondition turns the If-Match header into a precondition of the
+// update. Entity tags are compared strongly, so weak tags never match.
+func ifMatchPrecondition(ifMatch *string) (models.Precondition, error) {
+	if ifMatch == nil {
+		return models.Precondition{}, nil
+	}
+
+	tag := strings.TrimSpace(*ifMatch)
+	if tag == "*" {
+		return models.Precondition{}, nil
+	}
+	weak := strings.HasPrefix(tag, "W/")
+	if !isEntityTag(strings.TrimPrefix(tag, "W/")) {
+		return models.Precondition{}, errInvalidIfMatch
+	}
+	if weak {
+		return models.Precondition{}, models.ErrUserModified
+	}
+
+	updateTime, ok := parseUserETag(tag)
+	if !ok {
+		// No version of the user has this tag.
+		return models.Precondition{}, models.ErrUserModified
+	}
+
+	return models.Precondition{LastUpdateTime: updateTime}, nil
+}
+
+// ifNoneMatchHolds reports whether the user has none of the entity tags in
+// the If-None-Match header. Entity tags are compared weakly.
+func ifNoneMatchHolds(ifNoneMatch *string, user models.User) bool {
+	if ifNoneMatch == nil {
+		return true
+	}
+
+	etag := userETag(user)
+	for _, tag := range strings.Split(*ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isEntityTag(tag string) bool {
+	return len(tag) >= 2 &&
+		strings.HasPrefix(tag, `"`) &&
+		strings.HasSuffix(tag, `"`) &&
+		!strings.Contains(tag[1:len(tag)-1], `"`)
+}
+
+func parseUserETag(tag string) (time.Time, bool) {
+	nanos, err := strconv.ParseInt(tag[1:len(tag)-1], 36, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, nanos).UTC(), true
+}
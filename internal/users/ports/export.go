@@ -0,0 +1,248 @@
+package ports
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	commonerrors "github.com/shotokan/firebase-training/internal/common/errors"
+	"github.com/shotokan/firebase-training/internal/users/models"
+)
+
+const (
+	mimeNDJSON = "application/x-ndjson"
+	mimeCSV    = "text/csv"
+)
+
+var (
+	errUnsupportedFormat = errors.New("users can only be exported as " + mimeNDJSON + " or " + mimeCSV)
+)
+
+var defaultExportedFields = []UserField{
+	UserFieldId,
+	UserFieldName,
+	UserFieldEmail,
+	UserFieldRole,
+	UserFieldCreatedAt,
+	UserFieldUpdatedAt,
+	UserFieldCreatedBy,
+	UserFieldUpdatedBy,
+	UserFieldDeletedAt,
+}
+
+// exportedUserFields reads the exported fields of a user. There is
+// deliberately no way to export the password hash.
+var exportedUserFields = map[UserField]func(user models.User) interface{}{
+	UserFieldId:        func(u models.User) interface{} { return u.ID.String() },
+	UserFieldName:      func(u models.User) interface{} { return u.Name },
+	UserFieldEmail:     func(u models.User) interface{} { return u.Email },
+	UserFieldRole:      func(u models.User) interface{} { return u.Role },
+	UserFieldCreatedAt: func(u models.User) interface{} { return exportedTime(&u.CreatedAt) },
+	UserFieldUpdatedAt: func(u models.User) interface{} { return exportedTime(&u.UpdatedAt) },
+	UserFieldCreatedBy: func(u models.User) interface{} { return exportedString(u.CreatedBy) },
+	UserFieldUpdatedBy: func(u models.User) interface{} { return exportedString(u.UpdatedBy) },
+	UserFieldDeletedAt: func(u models.User) interface{} { return exportedTime(u.DeletedAt) },
+}
+
+// ExportUsers streams all users in the format negotiated with Accept. Users
+// are written as they are read from the repository, so memory use doesn't grow
+// with the number of users.
+func (h HttpServer) ExportUsers(ctx echo.Context, params ExportUsersParams) error {
+	if err := h.authorize(ctx.Request().Context(), UserActionExport, nil); err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	format, ok := negotiateExportFormat(ctx.Request().Header.Get(echo.HeaderAccept))
+	if !ok {
+		return commonerrors.NotAcceptable("unsupported-export-format", errUnsupportedFormat)
+	}
+
+	fields := defaultExportedFields
+	if params.Fields != nil && len(*params.Fields) > 0 {
+		fields = *params.Fields
+	}
+	includeDeleted := params.IncludeDeleted != nil && *params.IncludeDeleted
+	if includeDeleted {
+		if err := h.authorize(ctx.Request().Context(), UserActionReadDeleted, nil); err != nil {
+			return commonerrors.RespondWithSlugError(err)
+		}
+	}
+
+	ctx.Response().Header().Set(echo.HeaderContentType, format)
+
+	var writer userExportWriter
+	if format == mimeCSV {
+		writer = newCSVUserExportWriter(ctx.Response(), fields)
+	} else {
+		writer = newNDJSONUserExportWriter(ctx.Response(), fields)
+	}
+
+	err := h.repo.ExportUsers(ctx.Request().Context(), includeDeleted, writer.Write)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil && !ctx.Response().Committed {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	// Once streaming started the status can't change, the export is cut short.
+	return err
+}
+
+// negotiateExportFormat picks the export format preferred by the Accept
+// header, NDJSON when the client accepts anything.
+func negotiateExportFormat(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return mimeNDJSON, true
+	}
+
+	type mediaRange struct {
+		mediaType string
+		quality   float64
+	}
+
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality > 0 {
+			ranges = append(ranges, mediaRange{mediaType: mediaType, quality: quality})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+
+	for _, r := range ranges {
+		switch r.mediaType {
+		case mimeNDJSON, "application/*", "*/*":
+			return mimeNDJSON, true
+		case mimeCSV, "text/*":
+			return mimeCSV, true
+		}
+	}
+
+	return "", false
+}
+
+type userExportWriter interface {
+	Write(user models.User) error
+	Flush() error
+}
+
+type ndjsonUserExportWriter struct {
+	buffer  *bufio.Writer
+	encoder *json.Encoder
+	fields  []UserField
+}
+
+func newNDJSONUserExportWriter(w io.Writer, fields []UserField) *ndjsonUserExportWriter {
+	buffer := bufio.NewWriter(w)
+
+	return &ndjsonUserExportWriter{
+		buffer:  buffer,
+		encoder: json.NewEncoder(buffer),
+		fields:  fields,
+	}
+}
+
+func (w *ndjsonUserExportWriter) Write(user models.User) error {
+	row := make(map[string]interface{}, len(w.fields))
+	for _, field := range w.fields {
+		if value := exportedUserFields[field](user); value != nil {
+			row[string(field)] = value
+		}
+	}
+
+	return w.encoder.Encode(row)
+}
+
+func (w *ndjsonUserExportWriter) Flush() error {
+	return w.buffer.Flush()
+}
+
+type csvUserExportWriter struct {
+	writer        *csv.Writer
+	fields        []UserField
+	headerWritten bool
+}
+
+func newCSVUserExportWriter(w io.Writer, fields []UserField) *csvUserExportWriter {
+	return &csvUserExportWriter{
+		writer: csv.NewWriter(w),
+		fields: fields,
+	}
+}
+
+func (w *csvUserExportWriter) Write(user models.User) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	record := make([]string, len(w.fields))
+	for i, field := range w.fields {
+		if value := exportedUserFields[field](user); value != nil {
+			record[i] = value.(string)
+		}
+	}
+
+	return w.writer.Write(record)
+}
+
+func (w *csvUserExportWriter) Flush() error {
+	// An export without users still has the header.
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	w.writer.Flush()
+
+	return w.writer.Error()
+}
+
+func (w *csvUserExportWriter) writeHeader() error {
+	if w.headerWritten {
+		return nil
+	}
+	w.headerWritten = true
+
+	header := make([]string, len(w.fields))
+	for i, field := range w.fields {
+		header[i] = string(field)
+	}
+
+	return w.writer.Write(header)
+}
+
+func exportedTime(t *time.Time) interface{} {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func exportedString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+
+	return s
+}
@@ -2,55 +2,539 @@ package ports
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/shotokan/firebase-training/internal/common"
+	commonerrors "github.com/shotokan/firebase-training/internal/common/errors"
 	"github.com/shotokan/firebase-training/internal/users/models"
 )
 
 type UserRepository interface {
-	AddUser(ctx context.Context, user models.User) error
+	// AddUser stores a new user and returns it as stored, with its audit
+	// metadata.
+	AddUser(ctx context.Context, user models.User) (models.User, error)
+	// AddUsers stores many new users, each on its own. It returns the error of
+	// every user, nil for the users created. It fails as a whole only when the
+	// batch can't be written at all.
+	AddUsers(ctx context.Context, users []models.User) ([]error, error)
+	GetUser(ctx context.Context, userID uuid.UUID) (models.User, error)
+	// GetUsersByID returns the users with the given IDs, in the same order,
+	// with nil for the users which don't exist.
+	GetUsersByID(ctx context.Context, userIDs []uuid.UUID) ([]*models.User, error)
+	ListUsers(ctx context.Context, query models.UserQuery) (models.UserPage, error)
+	// ExportUsers calls fn with every user in ID order, one at a time, and
+	// without password hashes.
+	ExportUsers(ctx context.Context, includeDeleted bool, fn func(user models.User) error) error
+	// WatchUsers calls fn with every change of users after position, or
+	// after now when position is nil, until ctx is done or fn fails. Users
+	// removed for good are only reported as they are removed, a resumed
+	// watch doesn't see them. It returns nil once ctx is done.
+	WatchUsers(ctx context.Context, after *models.UserChangePosition, fn func(change models.UserChange) error) error
+	// UpdateUser applies updateFn to the user when it satisfies the
+	// precondition, and returns the user as stored.
+	UpdateUser(
+		ctx context.Context,
+		userID uuid.UUID,
+		precondition models.Precondition,
+		updateFn func(ctx context.Context, user *models.User) (*models.User, error),
+	) (models.User, error)
+	// DeleteUser removes the user for good, unlike soft-deleting it.
+	DeleteUser(ctx context.Context, userID uuid.UUID) error
+	// PurgeDeletedUsers removes for good users soft-deleted before deletedBefore.
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int, error)
 }
 
+// PasswordHasher turns plaintext passwords into hashes that are safe to store.
+type PasswordHasher interface {
+	HashPassword(password string) (string, error)
+}
+
+const defaultPageSize = 20
+
 //go:generate go run github.com/deepmap/oapi-codegen/cmd/oapi-codegen --config=server.cfg.yaml ../../../api/users.yml
 type HttpServer struct {
-	repo UserRepository
+	repo           UserRepository
+	passwordHasher PasswordHasher
+	pageTokens     PageTokenCodec
+	policies       UserPolicies
 }
 
-func NewHttpServer(repo UserRepository) *HttpServer {
+func NewHttpServer(repo UserRepository, passwordHasher PasswordHasher, pageTokens PageTokenCodec, policies UserPolicies) *HttpServer {
 	return &HttpServer{
-		repo: repo,
+		repo:           repo,
+		passwordHasher: passwordHasher,
+		pageTokens:     pageTokens,
+		policies:       policies,
 	}
 }
 
-func (h HttpServer) GetUsers(ctx echo.Context) error {
-	result := User{Name: "Ivan"}
+func (h HttpServer) GetUsers(ctx echo.Context, params GetUsersParams) error {
+	if err := h.authorize(ctx.Request().Context(), UserActionList, nil); err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	query := models.UserQuery{
+		Filter: models.UserFilter{
+			CreatedFrom: params.CreatedFrom,
+			CreatedTo:   params.CreatedTo,
+		},
+		Limit: defaultPageSize,
+	}
+	if params.Limit != nil {
+		query.Limit = *params.Limit
+	}
+	if params.EmailPrefix != nil {
+		query.Filter.EmailPrefix = *params.EmailPrefix
+	}
+	if params.Role != nil {
+		query.Filter.Role = string(*params.Role)
+	}
+	if params.IncludeDeleted != nil && *params.IncludeDeleted {
+		if err := h.authorize(ctx.Request().Context(), UserActionReadDeleted, nil); err != nil {
+			return commonerrors.RespondWithSlugError(err)
+		}
+		query.Filter.IncludeDeleted = true
+	}
+	if params.Sort != nil {
+		field, descending := strings.CutPrefix(string(*params.Sort), "-")
+		query.Sort = models.UserSort{Field: models.UserSortField(field), Descending: descending}
+	}
+	if params.PageToken != nil {
+		cursor, err := h.pageTokens.Decode(*params.PageToken, query)
+		if err != nil {
+			return commonerrors.RespondWithSlugError(err)
+		}
+		query.After = &cursor
+	}
+
+	page, err := h.repo.ListUsers(ctx.Request().Context(), query)
+	if err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	result := UserList{Users: make(Users, 0, len(page.Users))}
+	for _, user := range page.Users {
+		result.Users = append(result.Users, userModelToResponse(user))
+	}
+
+	if page.Next != nil {
+		nextPageToken, err := h.pageTokens.Encode(*page.Next, query)
+		if err != nil {
+			return commonerrors.RespondWithSlugError(err)
+		}
+		result.NextPageToken = &nextPageToken
+	}
+
 	return ctx.JSON(http.StatusOK, result)
 }
 
-func (h HttpServer) GetUserById(ctx echo.Context, userId int) error {
-	result := []User{{Name: "Ivan"}}
-	return ctx.JSON(http.StatusOK, result)
+func (h HttpServer) GetUserById(ctx echo.Context, userId uuid.UUID, params GetUserByIdParams) error {
+	user, err := h.repo.GetUser(ctx.Request().Context(), userId)
+	if err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+	if err := h.authorize(ctx.Request().Context(), UserActionRead, &user); err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+	includeDeleted := params.IncludeDeleted != nil && *params.IncludeDeleted
+	if includeDeleted {
+		if err := h.authorize(ctx.Request().Context(), UserActionReadDeleted, &user); err != nil {
+			return commonerrors.RespondWithSlugError(err)
+		}
+	}
+	if user.IsDeleted() && !includeDeleted {
+		return commonerrors.RespondWithSlugError(models.ErrUserNotFound)
+	}
+
+	ctx.Response().Header().Set(headerETag, userETag(user))
+	if !ifNoneMatchHolds(params.IfNoneMatch, user) {
+		return ctx.NoContent(http.StatusNotModified)
+	}
+
+	return ctx.JSON(http.StatusOK, userModelToResponse(user))
+}
+
+// CreateUser leaves the Idempotency-Key of params to the idempotency
+// middleware, registered for this route in main.
+func (h HttpServer) CreateUser(ctx echo.Context, _ CreateUserParams) error {
+	if err := h.authorize(ctx.Request().Context(), UserActionCreate, nil); err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	user := UserCreate{}
+	if err := ctx.Bind(&user); err != nil {
+		return commonerrors.BadRequest("invalid-request-body", err)
+	}
+	userModel, err := h.newUser(user)
+	if err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+	createdUser, err := h.repo.AddUser(ctx.Request().Context(), userModel)
+	if err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	ctx.Response().Header().Set(echo.HeaderLocation, path.Join(ctx.Request().URL.Path, createdUser.ID.String()))
+	ctx.Response().Header().Set(headerETag, userETag(createdUser))
+
+	return ctx.JSON(http.StatusCreated, userModelToResponse(createdUser))
+}
+
+// BatchCreateUsers creates every user of the batch on its own, so invalid or
+// conflicting users don't keep the others from being created.
+func (h HttpServer) BatchCreateUsers(ctx echo.Context) error {
+	if err := h.authorize(ctx.Request().Context(), UserActionCreate, nil); err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	batch := UserBatchCreate{}
+	if err := ctx.Bind(&batch); err != nil {
+		return commonerrors.BadRequest("invalid-request-body", err)
+	}
+
+	results := make([]UserBatchCreateResult, len(batch.Users))
+	userModels := make([]models.User, len(batch.Users))
+	errs := make([]error, len(batch.Users))
+
+	// Hashing passwords is slow on purpose, users are hashed in parallel.
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, runtime.GOMAXPROCS(0))
+	for i, user := range batch.Users {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(i int, user UserCreate) {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			userModels[i], errs[i] = h.newUser(user)
+		}(i, user)
+	}
+	wg.Wait()
+
+	var validUsers []models.User
+	var validPositions []int
+	for i, err := range errs {
+		if err != nil {
+			results[i].Error = batchItemError(err)
+			continue
+		}
+		validUsers = append(validUsers, userModels[i])
+		validPositions = append(validPositions, i)
+	}
+
+	if len(validUsers) > 0 {
+		addErrs, err := h.repo.AddUsers(ctx.Request().Context(), validUsers)
+		if err != nil {
+			return commonerrors.RespondWithSlugError(err)
+		}
+		for j, err := range addErrs {
+			i := validPositions[j]
+			if err != nil {
+				results[i].Error = batchItemError(err)
+				continue
+			}
+			id := validUsers[j].ID
+			results[i].Id = &id
+		}
+	}
+
+	return ctx.JSON(http.StatusOK, UserBatchCreateResults{Results: results})
+}
+
+func batchItemError(err error) *Error {
+	resp := commonerrors.SlugErrorResponse(err)
+	return &Error{Slug: resp.Slug, Message: resp.Message}
+}
+
+func (h HttpServer) BatchGetUsers(ctx echo.Context, params BatchGetUsersParams) error {
+	batch := UserBatchGet{}
+	if err := ctx.Bind(&batch); err != nil {
+		return commonerrors.BadRequest("invalid-request-body", err)
+	}
+	includeDeleted := params.IncludeDeleted != nil && *params.IncludeDeleted
+	if includeDeleted {
+		if err := h.authorize(ctx.Request().Context(), UserActionReadDeleted, nil); err != nil {
+			return commonerrors.RespondWithSlugError(err)
+		}
+	}
+
+	principal, err := common.UserFromCtx(ctx.Request().Context())
+	if err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	users, err := h.repo.GetUsersByID(ctx.Request().Context(), batch.Ids)
+	if err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	results := UserBatchGetResults{
+		Users:   make([]User, 0, len(users)),
+		Missing: []uuid.UUID{},
+	}
+	// Every user found is authorized, so users can get themselves too. The
+	// users which can't be read are missing like unknown IDs, so batches
+	// don't tell which IDs of other users exist.
+	for i, user := range users {
+		if user == nil || (user.IsDeleted() && !includeDeleted) ||
+			h.policies.Authorize(principal, UserActionRead, user) != nil {
+			results.Missing = append(results.Missing, batch.Ids[i])
+			continue
+		}
+		results.Users = append(results.Users, userModelToResponse(*user))
+	}
+
+	return ctx.JSON(http.StatusOK, results)
 }
 
-func (h HttpServer) CreateUser(ctx echo.Context) error {
-	user := User{}
-	err := ctx.Bind(&user)
+func (h HttpServer) ReplaceUser(ctx echo.Context, userId uuid.UUID, params ReplaceUserParams) error {
+	precondition, err := ifMatchPrecondition(params.IfMatch)
 	if err != nil {
-		return ctx.JSON(http.StatusBadRequest, Error{
-			Message: "something bad",
-		})
+		return commonerrors.RespondWithSlugError(err)
 	}
-	userModel := models.User{
-		Name:     user.Name,
-		Email:    user.Email,
-		Password: user.Password,
+
+	user := UserCreate{}
+	if err := ctx.Bind(&user); err != nil {
+		return commonerrors.BadRequest("invalid-request-body", err)
+	}
+	passwordHash, err := h.hashPassword(user.Password)
+	if err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	updatedUser, err := h.repo.UpdateUser(ctx.Request().Context(), userId, precondition, func(_ context.Context, u *models.User) (*models.User, error) {
+		if err := h.authorize(ctx.Request().Context(), UserActionUpdate, u); err != nil {
+			return nil, err
+		}
+		if u.IsDeleted() {
+			return nil, models.ErrUserNotFound
+		}
+
+		// Users keep their role and owner unless the replacement sets them.
+		role := u.Role
+		if user.Role != nil {
+			role = string(*user.Role)
+		}
+		replacement, err := models.NewUser(u.ID, user.Name, user.Email, role, passwordHash)
+		if err != nil {
+			return nil, err
+		}
+		replacement.AuthSubject = u.AuthSubject
+		if user.AuthSubject != nil {
+			replacement.AuthSubject = *user.AuthSubject
+		}
+		if err := h.authorizeChanges(ctx.Request().Context(), *u, replacement); err != nil {
+			return nil, err
+		}
+
+		u.Name = replacement.Name
+		u.Email = replacement.Email
+		u.Role = replacement.Role
+		u.AuthSubject = replacement.AuthSubject
+		u.PasswordHash = replacement.PasswordHash
+
+		return u, nil
+	})
+	if err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	ctx.Response().Header().Set(headerETag, userETag(updatedUser))
+
+	return ctx.JSON(http.StatusOK, userModelToResponse(updatedUser))
+}
+
+func (h HttpServer) PatchUser(ctx echo.Context, userId uuid.UUID, params PatchUserParams) error {
+	precondition, err := ifMatchPrecondition(params.IfMatch)
+	if err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	// echo only binds application/json bodies, merge patches are decoded by hand.
+	patch := UserPatch{}
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&patch); err != nil {
+		return commonerrors.BadRequest("invalid-request-body", err)
+	}
+
+	var passwordHash string
+	if patch.Password != nil {
+		passwordHash, err = h.hashPassword(patch.Password)
+		if err != nil {
+			return commonerrors.RespondWithSlugError(err)
+		}
+	}
+
+	updatedUser, err := h.repo.UpdateUser(ctx.Request().Context(), userId, precondition, func(_ context.Context, u *models.User) (*models.User, error) {
+		if err := h.authorize(ctx.Request().Context(), UserActionUpdate, u); err != nil {
+			return nil, err
+		}
+		if u.IsDeleted() {
+			return nil, models.ErrUserNotFound
+		}
+		before := *u
+
+		if patch.Name != nil {
+			if err := u.ChangeName(*patch.Name); err != nil {
+				return nil, err
+			}
+		}
+		if patch.Email != nil {
+			if err := u.ChangeEmail(*patch.Email); err != nil {
+				return nil, err
+			}
+		}
+		if patch.Password != nil {
+			if err := u.ChangePasswordHash(passwordHash); err != nil {
+				return nil, err
+			}
+		}
+		if patch.Role != nil {
+			if err := u.ChangeRole(string(*patch.Role)); err != nil {
+				return nil, err
+			}
+		}
+		if patch.AuthSubject != nil {
+			u.AuthSubject = *patch.AuthSubject
+		}
+		if err := h.authorizeChanges(ctx.Request().Context(), before, *u); err != nil {
+			return nil, err
+		}
+
+		return u, nil
+	})
+	if err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	ctx.Response().Header().Set(headerETag, userETag(updatedUser))
+
+	return ctx.JSON(http.StatusOK, userModelToResponse(updatedUser))
+}
+
+func (h HttpServer) DeleteUser(ctx echo.Context, userId uuid.UUID, params DeleteUserParams) error {
+	precondition, err := ifMatchPrecondition(params.IfMatch)
+	if err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	_, err = h.repo.UpdateUser(ctx.Request().Context(), userId, precondition, func(_ context.Context, u *models.User) (*models.User, error) {
+		if err := h.authorize(ctx.Request().Context(), UserActionDelete, u); err != nil {
+			return nil, err
+		}
+		if err := u.SoftDelete(time.Now().UTC()); err != nil {
+			return nil, err
+		}
+
+		return u, nil
+	})
+	if err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (h HttpServer) RestoreUser(ctx echo.Context, userId uuid.UUID, params RestoreUserParams) error {
+	precondition, err := ifMatchPrecondition(params.IfMatch)
+	if err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	restoredUser, err := h.repo.UpdateUser(ctx.Request().Context(), userId, precondition, func(_ context.Context, u *models.User) (*models.User, error) {
+		if err := h.authorize(ctx.Request().Context(), UserActionDelete, u); err != nil {
+			return nil, err
+		}
+		if err := u.Restore(); err != nil {
+			return nil, err
+		}
+
+		return u, nil
+	})
+	if err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	ctx.Response().Header().Set(headerETag, userETag(restoredUser))
+
+	return ctx.JSON(http.StatusOK, userModelToResponse(restoredUser))
+}
+
+// newUser validates a user to create, with a new ID.
+func (h HttpServer) newUser(user UserCreate) (models.User, error) {
+	passwordHash, err := h.hashPassword(user.Password)
+	if err != nil {
+		return models.User{}, err
 	}
-	err = h.repo.AddUser(ctx.Request().Context(), userModel)
+
+	userModel, err := models.NewUser(uuid.New(), user.Name, user.Email, roleOrDefault(user.Role), passwordHash)
 	if err != nil {
-		return ctx.JSON(http.StatusInternalServerError, Error{
-			Message: "something bad",
-		})
+		return models.User{}, err
+	}
+	if user.AuthSubject != nil {
+		userModel.AuthSubject = *user.AuthSubject
 	}
-	return ctx.JSON(http.StatusCreated, nil)
+
+	return userModel, nil
+}
+
+// hashPassword checks the strength of the plaintext password before hashing it.
+func (h HttpServer) hashPassword(password *string) (string, error) {
+	if password == nil {
+		return "", models.ErrMissingPassword
+	}
+	if err := models.ValidatePassword(*password); err != nil {
+		return "", err
+	}
+
+	return h.passwordHasher.HashPassword(*password)
+}
+
+func roleOrDefault(role *Role) string {
+	if role == nil {
+		return models.RoleUser
+	}
+
+	return string(*role)
+}
+
+func userModelToResponse(user models.User) User {
+	id := user.ID
+	createdAt := user.CreatedAt
+
+	response := User{
+		Id:        &id,
+		Name:      user.Name,
+		Email:     user.Email,
+		Role:      Role(user.Role),
+		Profile:   profileModelToResponse(user.Profile),
+		CreatedAt: &createdAt,
+		DeletedAt: user.DeletedAt,
+	}
+	// Users written before audit metadata was recorded have none.
+	if !user.UpdatedAt.IsZero() {
+		updatedAt := user.UpdatedAt
+		response.UpdatedAt = &updatedAt
+	}
+	if user.AuthSubject != "" {
+		authSubject := user.AuthSubject
+		response.AuthSubject = &authSubject
+	}
+	if user.CreatedBy != "" {
+		createdBy := user.CreatedBy
+		response.CreatedBy = &createdBy
+	}
+	if user.UpdatedBy != "" {
+		updatedBy := user.UpdatedBy
+		response.UpdatedBy = &updatedBy
+	}
+
+	return response
 }
@@ -0,0 +1,298 @@
+package ports_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/lestrrat-go/jwx/jwt"
+	middleware "github.com/oapi-codegen/echo-middleware"
+	"github.com/shotokan/firebase-training/internal/common"
+	"github.com/shotokan/firebase-training/internal/users/adapters"
+	"github.com/shotokan/firebase-training/internal/users/models"
+	"github.com/shotokan/firebase-training/internal/users/ports"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testSubject = "amy-subject"
+
+// TestCreateUserRecordsCreator sends requests through the same middleware as
+// main, so the user of the token must reach the repository.
+func TestCreateUserRecordsCreator(t *testing.T) {
+	fa, err := common.NewFakeAuthenticator()
+	if err != nil {
+		t.Fatalf("creating fake authenticator: %v", err)
+	}
+	writer := signToken(t, fa, models.RoleAdmin, []string{"users:read", "users:write"})
+	reader := signToken(t, fa, models.RoleAdmin, []string{"users:read"})
+
+	tests := []struct {
+		name           string
+		token          string
+		withoutUserCtx bool
+		wantStatus     int
+		wantSlug       string
+	}{
+		{name: "authenticated", token: writer, wantStatus: http.StatusCreated},
+		{name: "no token", wantStatus: http.StatusUnauthorized, wantSlug: "missing-bearer-token"},
+		{name: "token lacking the write scope", token: reader, wantStatus: http.StatusForbidden, wantSlug: "insufficient-scope"},
+		{name: "user not passed to the request context", token: writer, withoutUserCtx: true, wantStatus: http.StatusUnauthorized, wantSlug: "no-user-found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestServer(t, fa, adapters.NewUserMemoryRepository(), !tt.withoutUserCtx)
+
+			body := `{"name":"amy","email":"amy@example.com","password":"passw0rd!"}`
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			if tt.token != "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantSlug != "" {
+				var resp ports.Error
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("decoding error: %v", err)
+				}
+				if resp.Slug != tt.wantSlug {
+					t.Errorf("got slug %q, want %q", resp.Slug, tt.wantSlug)
+				}
+				return
+			}
+
+			var created ports.User
+			if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+				t.Fatalf("decoding created user: %v", err)
+			}
+			if created.CreatedBy == nil || *created.CreatedBy != testSubject {
+				t.Errorf("got createdBy %v, want %q", created.CreatedBy, testSubject)
+			}
+		})
+	}
+}
+
+// TestCreateUserRejectsUnboundBody calls the handlers without the validator,
+// which would reject the bodies first.
+func TestCreateUserRejectsUnboundBody(t *testing.T) {
+	hasher, err := adapters.NewBcryptPasswordHasher(bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("creating password hasher: %v", err)
+	}
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := common.WithUser(c.Request().Context(), common.User{UUID: testSubject, Role: models.RoleAdmin})
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	})
+	users := ports.NewHttpServer(adapters.NewUserMemoryRepository(), hasher, ports.NewPageTokenCodec([]byte("test-secret")), ports.DefaultUserPolicies)
+	ports.RegisterHandlers(ports.NewCustomMethodRouter(e), users)
+
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{name: "malformed user", path: "/users", body: `{"name":`},
+		{name: "name of the wrong type", path: "/users", body: `{"name":42}`},
+		{name: "malformed batch", path: "/users:batchCreate", body: `{"users":[`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+			}
+			var resp ports.Error
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decoding error: %v", err)
+			}
+			if resp.Slug != "invalid-request-body" || resp.Message == "" {
+				t.Errorf("got %+v, want an invalid-request-body error", resp)
+			}
+		})
+	}
+}
+
+// TestBatchGetUsersReportsUnreadableUsersMissing checks that users learn
+// nothing about the users of others, unknown or not.
+func TestBatchGetUsersReportsUnreadableUsersMissing(t *testing.T) {
+	fa, err := common.NewFakeAuthenticator()
+	if err != nil {
+		t.Fatalf("creating fake authenticator: %v", err)
+	}
+
+	repo := adapters.NewUserMemoryRepository()
+	ctx := common.WithUser(context.Background(), common.User{UUID: "admin-subject", Role: models.RoleAdmin})
+	own := addTestUser(t, ctx, repo, "amy@example.com", testSubject)
+	other := addTestUser(t, ctx, repo, "bo@example.com", "bo-subject")
+	unknown := uuid.New()
+
+	e := newTestServer(t, fa, repo, true)
+	body := fmt.Sprintf(`{"ids":[%q,%q,%q]}`, own.ID, other.ID, unknown)
+	req := httptest.NewRequest(http.MethodPost, "/users:batchGet", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+signToken(t, fa, models.RoleUser, []string{"users:read"}))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var results ports.UserBatchGetResults
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+		t.Fatalf("decoding results: %v", err)
+	}
+	if len(results.Users) != 1 || *results.Users[0].Id != own.ID {
+		t.Errorf("got users %+v, want only %s", results.Users, own.ID)
+	}
+	if len(results.Missing) != 2 || results.Missing[0] != other.ID || results.Missing[1] != unknown {
+		t.Errorf("got missing %v, want %s and %s", results.Missing, other.ID, unknown)
+	}
+}
+
+// TestPatchUserDecodesMergePatch checks that the validator decodes and
+// validates JSON Merge Patch bodies, without main registering their decoder.
+func TestPatchUserDecodesMergePatch(t *testing.T) {
+	fa, err := common.NewFakeAuthenticator()
+	if err != nil {
+		t.Fatalf("creating fake authenticator: %v", err)
+	}
+	token := signToken(t, fa, models.RoleUser, []string{"users:read", "users:write"})
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantName   string
+	}{
+		{name: "name changed", body: `{"name":"Amy Pond"}`, wantStatus: http.StatusOK, wantName: "Amy Pond"},
+		{name: "empty patch", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "name of the wrong type", body: `{"name":42}`, wantStatus: http.StatusBadRequest},
+		{name: "malformed body", body: `{"name":`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := adapters.NewUserMemoryRepository()
+			ctx := common.WithUser(context.Background(), common.User{UUID: "admin-subject", Role: models.RoleAdmin})
+			user := addTestUser(t, ctx, repo, "amy@example.com", testSubject)
+
+			e := newTestServer(t, fa, repo, true)
+			req := httptest.NewRequest(http.MethodPatch, "/users/"+user.ID.String(), strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, "application/merge-patch+json")
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var patched ports.User
+			if err := json.Unmarshal(rec.Body.Bytes(), &patched); err != nil {
+				t.Fatalf("decoding patched user: %v", err)
+			}
+			if patched.Name != tt.wantName {
+				t.Errorf("got name %q, want %q", patched.Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func addTestUser(t *testing.T, ctx context.Context, repo ports.UserRepository, email string, authSubject string) models.User {
+	t.Helper()
+
+	user, err := models.NewUser(uuid.New(), "user", email, models.RoleUser, "hash")
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	user.AuthSubject = authSubject
+
+	added, err := repo.AddUser(ctx, user)
+	if err != nil {
+		t.Fatalf("adding user: %v", err)
+	}
+
+	return added
+}
+
+// newTestServer wires the handlers like main, with repo and jws tokens.
+// withUserCtx leaves out common.UserContextMiddleware when false.
+func newTestServer(t *testing.T, fa *common.FakeAuthenticator, repo ports.UserRepository, withUserCtx bool) *echo.Echo {
+	t.Helper()
+
+	spec, err := ports.GetSwagger()
+	if err != nil {
+		t.Fatalf("loading spec: %v", err)
+	}
+	spec.Servers = nil
+
+	verifier := common.NewJWSVerifier(fa, common.NewClaimsDecoder(models.RoleUser))
+	e := echo.New()
+	e.Use(middleware.OapiRequestValidatorWithOptions(spec, &middleware.Options{
+		Options: openapi3filter.Options{
+			AuthenticationFunc: common.NewAuthenticator(verifier),
+		},
+	}))
+	if withUserCtx {
+		e.Use(common.UserContextMiddleware())
+	}
+
+	hasher, err := adapters.NewBcryptPasswordHasher(bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("creating password hasher: %v", err)
+	}
+	users := ports.NewHttpServer(repo, hasher, ports.NewPageTokenCodec([]byte("test-secret")), ports.DefaultUserPolicies)
+	ports.RegisterHandlers(ports.NewCustomMethodRouter(e), users)
+
+	return e
+}
+
+// signToken issues a token to testSubject, accepted by fa.
+func signToken(t *testing.T, fa *common.FakeAuthenticator, role string, permissions []string) string {
+	t.Helper()
+
+	token := jwt.New()
+	claims := map[string]interface{}{
+		jwt.IssuerKey:           common.FakeIssuer,
+		jwt.AudienceKey:         common.FakeAudience,
+		jwt.SubjectKey:          testSubject,
+		"role":                  role,
+		common.PermissionsClaim: permissions,
+	}
+	for name, value := range claims {
+		if err := token.Set(name, value); err != nil {
+			t.Fatalf("setting %s claim: %v", name, err)
+		}
+	}
+
+	signed, err := fa.SignToken(token)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+
+	return string(signed)
+}
@@ -0,0 +1,10 @@
+package ports
+
+import "github.com/getkin/kin-openapi/openapi3filter"
+
+// The request validator decodes bodies with the decoder registered for their
+// media type. JSON Merge Patch bodies, taken by PatchUser, are plain JSON
+// documents.
+func init() {
+	openapi3filter.RegisterBodyDecoder("application/merge-patch+json", openapi3filter.RegisteredBodyDecoder("application/json"))
+}
@@ -0,0 +1,101 @@
+package ports
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	commonerrors "github.com/shotokan/firebase-training/internal/common/errors"
+	"github.com/shotokan/firebase-training/internal/users/models"
+)
+
+var errInvalidPageToken = commonerrors.NewIncorrectInputError("page token is invalid", "invalid-page-token")
+
+// PageTokenCodec turns cursors into opaque page tokens. Tokens are signed
+// with HMAC-SHA256, so clients can't forge cursors, and are bound to the
+// filters and sort of the query they were issued for.
+type PageTokenCodec struct {
+	secret []byte
+}
+
+func NewPageTokenCodec(secret []byte) PageTokenCodec {
+	return PageTokenCodec{secret: secret}
+}
+
+type pageToken struct {
+	Cursor models.UserCursor `json:"c"`
+	Query  string            `json:"q"`
+}
+
+func (c PageTokenCodec) Encode(cursor models.UserCursor, query models.UserQuery) (string, error) {
+	payload, err := json.Marshal(pageToken{Cursor: cursor, Query: queryFingerprint(query)})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(c.sign(payload)), nil
+}
+
+func (c PageTokenCodec) Decode(token string, query models.UserQuery) (models.UserCursor, error) {
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return models.UserCursor{}, errInvalidPageToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return models.UserCursor{}, errInvalidPageToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return models.UserCursor{}, errInvalidPageToken
+	}
+
+	if !hmac.Equal(signature, c.sign(payload)) {
+		return models.UserCursor{}, errInvalidPageToken
+	}
+
+	decoded := pageToken{}
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		return models.UserCursor{}, errInvalidPageToken
+	}
+	if decoded.Query != queryFingerprint(query) {
+		return models.UserCursor{}, errInvalidPageToken
+	}
+
+	return decoded.Cursor, nil
+}
+
+func (c PageTokenCodec) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write(payload)
+
+	return mac.Sum(nil)
+}
+
+// queryFingerprint identifies the filters and sort of the query, but not its
+// limit, so page sizes can change between pages.
+func queryFingerprint(query models.UserQuery) string {
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+
+	fingerprint := strings.Join([]string{
+		models.NormalizedEmail(query.Filter.EmailPrefix),
+		query.Filter.Role,
+		formatTime(query.Filter.CreatedFrom),
+		formatTime(query.Filter.CreatedTo),
+		string(query.Sort.Field),
+		strconv.FormatBool(query.Sort.Descending),
+	}, "\x00")
+	sum := sha256.Sum256([]byte(fingerprint))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
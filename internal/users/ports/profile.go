@@ -0,0 +1,102 @@
+package ports
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	commonerrors "github.com/shotokan/firebase-training/internal/common/errors"
+	"github.com/shotokan/firebase-training/internal/users/models"
+)
+
+func (h HttpServer) GetUserProfile(ctx echo.Context, userId uuid.UUID, params GetUserProfileParams) error {
+	user, err := h.repo.GetUser(ctx.Request().Context(), userId)
+	if err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+	if err := h.authorize(ctx.Request().Context(), UserActionRead, &user); err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+	if user.IsDeleted() {
+		return commonerrors.RespondWithSlugError(models.ErrUserNotFound)
+	}
+
+	ctx.Response().Header().Set(headerETag, userETag(user))
+	if !ifNoneMatchHolds(params.IfNoneMatch, user) {
+		return ctx.NoContent(http.StatusNotModified)
+	}
+
+	return ctx.JSON(http.StatusOK, profileModelToResponse(user.Profile))
+}
+
+// ReplaceUserProfile changes the profile only, so it can be authorized apart
+// from the account fields of the user.
+func (h HttpServer) ReplaceUserProfile(ctx echo.Context, userId uuid.UUID, params ReplaceUserProfileParams) error {
+	precondition, err := ifMatchPrecondition(params.IfMatch)
+	if err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	body := UserProfile{}
+	if err := ctx.Bind(&body); err != nil {
+		return commonerrors.BadRequest("invalid-request-body", err)
+	}
+	profile, err := models.NewUserProfile(
+		stringOrEmpty(body.Phone),
+		stringOrEmpty(body.Locale),
+		stringOrEmpty(body.Timezone),
+		stringOrEmpty(body.AvatarUrl),
+		stringOrEmpty(body.Bio),
+	)
+	if err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	updatedUser, err := h.repo.UpdateUser(ctx.Request().Context(), userId, precondition, func(_ context.Context, u *models.User) (*models.User, error) {
+		if err := h.authorize(ctx.Request().Context(), UserActionUpdate, u); err != nil {
+			return nil, err
+		}
+		if u.IsDeleted() {
+			return nil, models.ErrUserNotFound
+		}
+
+		u.ChangeProfile(profile)
+
+		return u, nil
+	})
+	if err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	ctx.Response().Header().Set(headerETag, userETag(updatedUser))
+
+	return ctx.JSON(http.StatusOK, profileModelToResponse(updatedUser.Profile))
+}
+
+// profileModelToResponse leaves out the fields which are not set.
+func profileModelToResponse(profile models.UserProfile) UserProfile {
+	return UserProfile{
+		Phone:     emptyToNil(profile.Phone),
+		Locale:    emptyToNil(profile.Locale),
+		Timezone:  emptyToNil(profile.Timezone),
+		AvatarUrl: emptyToNil(profile.AvatarURL),
+		Bio:       emptyToNil(profile.Bio),
+	}
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
+
+func emptyToNil(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
@@ -0,0 +1,61 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"github.com/shotokan/firebase-training/internal/common"
+	"github.com/sirupsen/logrus"
+)
+
+// DeletedUsersPurger periodically removes for good the users which stayed
+// soft-deleted for longer than the retention period.
+type DeletedUsersPurger struct {
+	repo      UserRepository
+	retention time.Duration
+	interval  time.Duration
+}
+
+func NewDeletedUsersPurger(repo UserRepository, retention time.Duration, interval time.Duration) *DeletedUsersPurger {
+	return &DeletedUsersPurger{
+		repo:      repo,
+		retention: retention,
+		interval:  interval,
+	}
+}
+
+// Run purges once every interval, until ctx is done. An interval of zero or
+// less disables purging.
+func (p DeletedUsersPurger) Run(ctx context.Context) {
+	if p.interval <= 0 {
+		logrus.Info("Purging deleted users is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Purge(ctx); err != nil {
+			logrus.WithError(err).Error("Unable to purge deleted users")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge is a system operation, no user has to be authenticated in ctx.
+func (p DeletedUsersPurger) Purge(ctx context.Context) error {
+	deletedBefore := time.Now().Add(-p.retention)
+
+	purged, err := p.repo.PurgeDeletedUsers(common.WithSystemOperation(ctx), deletedBefore)
+	if purged > 0 {
+		logrus.WithField("purged", purged).WithField("deleted_before", deletedBefore).Info("Purged deleted users")
+	}
+
+	return err
+}
@@ -0,0 +1,28 @@
+package ports_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shotokan/firebase-training/internal/users/adapters"
+	"github.com/shotokan/firebase-training/internal/users/ports"
+)
+
+func TestDeletedUsersPurgerDisabled(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Minute} {
+		purger := ports.NewDeletedUsersPurger(adapters.NewUserMemoryRepository(), time.Hour, interval)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			purger.Run(context.Background())
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("Run with interval %v didn't return", interval)
+		}
+	}
+}
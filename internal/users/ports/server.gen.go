@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/labstack/echo/v4"
@@ -23,37 +24,349 @@ const (
 	BearerAuthScopes = "bearerAuth.Scopes"
 )
 
+// Defines values for Role.
+const (
+	RoleAdmin   Role = "admin"
+	RoleTrainer Role = "trainer"
+	RoleUser    Role = "user"
+)
+
+// Defines values for UserField.
+const (
+	UserFieldCreatedAt UserField = "createdAt"
+	UserFieldCreatedBy UserField = "createdBy"
+	UserFieldDeletedAt UserField = "deletedAt"
+	UserFieldEmail     UserField = "email"
+	UserFieldId        UserField = "id"
+	UserFieldName      UserField = "name"
+	UserFieldRole      UserField = "role"
+	UserFieldUpdatedAt UserField = "updatedAt"
+	UserFieldUpdatedBy UserField = "updatedBy"
+)
+
+// Defines values for GetUsersParamsSort.
+const (
+	GetUsersParamsSortCreatedAt      GetUsersParamsSort = "createdAt"
+	GetUsersParamsSortEmail          GetUsersParamsSort = "email"
+	GetUsersParamsSortMinusCreatedAt GetUsersParamsSort = "-createdAt"
+	GetUsersParamsSortMinusEmail     GetUsersParamsSort = "-email"
+	GetUsersParamsSortMinusName      GetUsersParamsSort = "-name"
+	GetUsersParamsSortName           GetUsersParamsSort = "name"
+)
+
+// AuthSubject Subject of the tokens of the person owning the user, who may read and update it
+type AuthSubject = string
+
 // Error defines model for Error.
 type Error struct {
 	Message string `json:"message"`
 	Slug    string `json:"slug"`
 }
 
+// Role defines model for Role.
+type Role string
+
 // User defines model for User.
 type User struct {
-	Email    string              `json:"email"`
-	Id       *openapi_types.UUID `json:"id,omitempty"`
-	Name     string              `json:"name"`
-	Password string              `json:"password"`
+	// AuthSubject Subject of the tokens of the person owning the user, who may read and update it
+	AuthSubject *AuthSubject `json:"authSubject,omitempty"`
+	CreatedAt   *time.Time   `json:"createdAt,omitempty"`
+
+	// CreatedBy ID of the user who created the user, or "system"
+	CreatedBy *string `json:"createdBy,omitempty"`
+
+	// DeletedAt Set while the user is soft-deleted
+	DeletedAt *time.Time          `json:"deletedAt,omitempty"`
+	Email     string              `json:"email"`
+	Id        *openapi_types.UUID `json:"id,omitempty"`
+	Name      string              `json:"name"`
+
+	// Profile Optional personal details of the user, changed through /users/{userId}/profile
+	Profile UserProfile `json:"profile"`
+	Role    Role        `json:"role"`
+
+	// UpdatedAt Time of the last change
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+
+	// UpdatedBy ID of the user who last changed the user, or "system"
+	UpdatedBy *string `json:"updatedBy,omitempty"`
+}
+
+// UserBatchCreate defines model for UserBatchCreate.
+type UserBatchCreate struct {
+	Users []UserCreate `json:"users"`
+}
+
+// UserBatchCreateResult Either the ID of the created user or why it wasn't created
+type UserBatchCreateResult struct {
+	Error *Error              `json:"error,omitempty"`
+	Id    *openapi_types.UUID `json:"id,omitempty"`
+}
+
+// UserBatchCreateResults defines model for UserBatchCreateResults.
+type UserBatchCreateResults struct {
+	Results []UserBatchCreateResult `json:"results"`
+}
+
+// UserBatchGet defines model for UserBatchGet.
+type UserBatchGet struct {
+	Ids []openapi_types.UUID `json:"ids"`
+}
+
+// UserBatchGetResults defines model for UserBatchGetResults.
+type UserBatchGetResults struct {
+	Missing []openapi_types.UUID `json:"missing"`
+	Users   []User               `json:"users"`
+}
+
+// UserCreate defines model for UserCreate.
+type UserCreate struct {
+	// AuthSubject Subject of the tokens of the person owning the user, who may read and update it
+	AuthSubject *AuthSubject `json:"authSubject,omitempty"`
+	Email       string       `json:"email"`
+	Name        string       `json:"name"`
+	Password    *string      `json:"password,omitempty"`
+	Role        *Role        `json:"role,omitempty"`
+}
+
+// UserField defines model for UserField.
+type UserField string
+
+// UserList defines model for UserList.
+type UserList struct {
+	// NextPageToken Token of the next page, missing on the last page
+	NextPageToken *string `json:"nextPageToken,omitempty"`
+	Users         Users   `json:"users"`
+}
+
+// UserPatch defines model for UserPatch.
+type UserPatch struct {
+	// AuthSubject Subject of the tokens of the person owning the user, who may read and update it
+	AuthSubject *AuthSubject `json:"authSubject,omitempty"`
+	Email       *string      `json:"email,omitempty"`
+	Name        *string      `json:"name,omitempty"`
+	Password    *string      `json:"password,omitempty"`
+	Role        *Role        `json:"role,omitempty"`
+}
+
+// UserProfile Optional personal details of the user, changed through /users/{userId}/profile
+type UserProfile struct {
+	// AvatarUrl http or https URL of the avatar image
+	AvatarUrl *string `json:"avatarUrl,omitempty"`
+
+	// Bio Up to 500 characters
+	Bio *string `json:"bio,omitempty"`
+
+	// Locale BCP 47 language tag, like en-US
+	Locale *string `json:"locale,omitempty"`
+
+	// Phone E.164 number, like +14155550123
+	Phone *string `json:"phone,omitempty"`
+
+	// Timezone IANA time zone name, like Europe/Madrid
+	Timezone *string `json:"timezone,omitempty"`
 }
 
 // Users defines model for Users.
 type Users = []User
 
+// IdempotencyKey defines model for IdempotencyKey.
+type IdempotencyKey = string
+
+// IfMatch defines model for IfMatch.
+type IfMatch = string
+
+// IfNoneMatch defines model for IfNoneMatch.
+type IfNoneMatch = string
+
+// IncludeDeleted defines model for IncludeDeleted.
+type IncludeDeleted = bool
+
+// UserId defines model for UserId.
+type UserId = openapi_types.UUID
+
+// BadRequest defines model for BadRequest.
+type BadRequest = Error
+
+// Conflict defines model for Conflict.
+type Conflict = Error
+
+// NotAcceptable defines model for NotAcceptable.
+type NotAcceptable = Error
+
+// NotFound defines model for NotFound.
+type NotFound = Error
+
+// PreconditionFailed defines model for PreconditionFailed.
+type PreconditionFailed = Error
+
+// UnexpectedError defines model for UnexpectedError.
+type UnexpectedError = Error
+
+// Unprocessable defines model for Unprocessable.
+type Unprocessable = Error
+
+// GetUsersParams defines parameters for GetUsers.
+type GetUsersParams struct {
+	// Limit Maximum number of users in the page
+	Limit *int `form:"limit,omitempty" json:"limit,omitempty"`
+
+	// PageToken Token of the page to get, as returned in nextPageToken
+	PageToken *string `form:"pageToken,omitempty" json:"pageToken,omitempty"`
+
+	// EmailPrefix Only users whose email starts with this prefix, ignoring case
+	EmailPrefix *string `form:"emailPrefix,omitempty" json:"emailPrefix,omitempty"`
+
+	// Role Only users with this role
+	Role *Role `form:"role,omitempty" json:"role,omitempty"`
+
+	// CreatedFrom Only users created at or after this time
+	CreatedFrom *time.Time `form:"createdFrom,omitempty" json:"createdFrom,omitempty"`
+
+	// CreatedTo Only users created before this time
+	CreatedTo *time.Time `form:"createdTo,omitempty" json:"createdTo,omitempty"`
+
+	// Sort Field to sort by, descending when prefixed with '-'. When filtering by email or creation date the page must be sorted by the filtered field.
+	Sort *GetUsersParamsSort `form:"sort,omitempty" json:"sort,omitempty"`
+
+	// IncludeDeleted Also return soft-deleted users, for admins
+	IncludeDeleted *IncludeDeleted `form:"includeDeleted,omitempty" json:"includeDeleted,omitempty"`
+}
+
+// GetUsersParamsSort defines parameters for GetUsers.
+type GetUsersParamsSort string
+
+// CreateUserParams defines parameters for CreateUser.
+type CreateUserParams struct {
+	// IdempotencyKey Unique key of the request, retries with the same key get the response of the first request. Keys are kept for a day, and can't be reused for another request meanwhile.
+	IdempotencyKey *IdempotencyKey `json:"Idempotency-Key,omitempty"`
+}
+
+// DeleteUserParams defines parameters for DeleteUser.
+type DeleteUserParams struct {
+	// IfMatch ETag of the user, the request fails unless the user still has this version
+	IfMatch *IfMatch `json:"If-Match,omitempty"`
+}
+
+// GetUserByIdParams defines parameters for GetUserById.
+type GetUserByIdParams struct {
+	// IncludeDeleted Also return soft-deleted users, for admins
+	IncludeDeleted *IncludeDeleted `form:"includeDeleted,omitempty" json:"includeDeleted,omitempty"`
+
+	// IfNoneMatch ETag of the user, the user is only returned when it has another version
+	IfNoneMatch *IfNoneMatch `json:"If-None-Match,omitempty"`
+}
+
+// PatchUserParams defines parameters for PatchUser.
+type PatchUserParams struct {
+	// IfMatch ETag of the user, the request fails unless the user still has this version
+	IfMatch *IfMatch `json:"If-Match,omitempty"`
+}
+
+// ReplaceUserParams defines parameters for ReplaceUser.
+type ReplaceUserParams struct {
+	// IfMatch ETag of the user, the request fails unless the user still has this version
+	IfMatch *IfMatch `json:"If-Match,omitempty"`
+}
+
+// GetUserProfileParams defines parameters for GetUserProfile.
+type GetUserProfileParams struct {
+	// IfNoneMatch ETag of the user, the user is only returned when it has another version
+	IfNoneMatch *IfNoneMatch `json:"If-None-Match,omitempty"`
+}
+
+// ReplaceUserProfileParams defines parameters for ReplaceUserProfile.
+type ReplaceUserProfileParams struct {
+	// IfMatch ETag of the user, the request fails unless the user still has this version
+	IfMatch *IfMatch `json:"If-Match,omitempty"`
+}
+
+// RestoreUserParams defines parameters for RestoreUser.
+type RestoreUserParams struct {
+	// IfMatch ETag of the user, the request fails unless the user still has this version
+	IfMatch *IfMatch `json:"If-Match,omitempty"`
+}
+
+// BatchGetUsersParams defines parameters for BatchGetUsers.
+type BatchGetUsersParams struct {
+	// IncludeDeleted Also return soft-deleted users, for admins
+	IncludeDeleted *IncludeDeleted `form:"includeDeleted,omitempty" json:"includeDeleted,omitempty"`
+}
+
+// ExportUsersParams defines parameters for ExportUsers.
+type ExportUsersParams struct {
+	// Fields Fields to export, in this order, all of them by default
+	Fields *[]UserField `form:"fields,omitempty" json:"fields,omitempty"`
+
+	// IncludeDeleted Also return soft-deleted users, for admins
+	IncludeDeleted *IncludeDeleted `form:"includeDeleted,omitempty" json:"includeDeleted,omitempty"`
+}
+
+// WatchUsersParams defines parameters for WatchUsers.
+type WatchUsersParams struct {
+	// LastEventID ID of the last event received, to resume the feed after it
+	LastEventID *string `json:"Last-Event-ID,omitempty"`
+}
+
 // CreateUserJSONRequestBody defines body for CreateUser for application/json ContentType.
-type CreateUserJSONRequestBody = User
+type CreateUserJSONRequestBody = UserCreate
+
+// PatchUserApplicationMergePatchPlusJSONRequestBody defines body for PatchUser for application/merge-patch+json ContentType.
+type PatchUserApplicationMergePatchPlusJSONRequestBody = UserPatch
+
+// ReplaceUserJSONRequestBody defines body for ReplaceUser for application/json ContentType.
+type ReplaceUserJSONRequestBody = UserCreate
+
+// ReplaceUserProfileJSONRequestBody defines body for ReplaceUserProfile for application/json ContentType.
+type ReplaceUserProfileJSONRequestBody = UserProfile
+
+// BatchCreateUsersJSONRequestBody defines body for BatchCreateUsers for application/json ContentType.
+type BatchCreateUsersJSONRequestBody = UserBatchCreate
+
+// BatchGetUsersJSONRequestBody defines body for BatchGetUsers for application/json ContentType.
+type BatchGetUsersJSONRequestBody = UserBatchGet
 
 // ServerInterface represents all server handlers.
 type ServerInterface interface {
 
 	// (GET /users)
-	GetUsers(ctx echo.Context) error
+	GetUsers(ctx echo.Context, params GetUsersParams) error
 
 	// (POST /users)
-	CreateUser(ctx echo.Context) error
+	CreateUser(ctx echo.Context, params CreateUserParams) error
+
+	// (DELETE /users/{userId})
+	DeleteUser(ctx echo.Context, userId UserId, params DeleteUserParams) error
 
 	// (GET /users/{userId})
-	GetUserById(ctx echo.Context, userId int) error
+	GetUserById(ctx echo.Context, userId UserId, params GetUserByIdParams) error
+
+	// (PATCH /users/{userId})
+	PatchUser(ctx echo.Context, userId UserId, params PatchUserParams) error
+
+	// (PUT /users/{userId})
+	ReplaceUser(ctx echo.Context, userId UserId, params ReplaceUserParams) error
+
+	// (GET /users/{userId}/profile)
+	GetUserProfile(ctx echo.Context, userId UserId, params GetUserProfileParams) error
+
+	// (PUT /users/{userId}/profile)
+	ReplaceUserProfile(ctx echo.Context, userId UserId, params ReplaceUserProfileParams) error
+
+	// (POST /users/{userId}:restore)
+	RestoreUser(ctx echo.Context, userId UserId, params RestoreUserParams) error
+
+	// (POST /users:batchCreate)
+	BatchCreateUsers(ctx echo.Context) error
+
+	// (POST /users:batchGet)
+	BatchGetUsers(ctx echo.Context, params BatchGetUsersParams) error
+
+	// (GET /users:export)
+	ExportUsers(ctx echo.Context, params ExportUsersParams) error
+
+	// (GET /users:watch)
+	WatchUsers(ctx echo.Context, params WatchUsersParams) error
 }
 
 // ServerInterfaceWrapper converts echo contexts to parameters.
@@ -65,10 +378,68 @@ type ServerInterfaceWrapper struct {
 func (w *ServerInterfaceWrapper) GetUsers(ctx echo.Context) error {
 	var err error
 
-	ctx.Set(BearerAuthScopes, []string{})
+	ctx.Set(BearerAuthScopes, []string{"users:read"})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetUsersParams
+	// ------------- Optional query parameter "limit" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", ctx.QueryParams(), &params.Limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter limit: %s", err))
+	}
+
+	// ------------- Optional query parameter "pageToken" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "pageToken", ctx.QueryParams(), &params.PageToken)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter pageToken: %s", err))
+	}
+
+	// ------------- Optional query parameter "emailPrefix" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "emailPrefix", ctx.QueryParams(), &params.EmailPrefix)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter emailPrefix: %s", err))
+	}
+
+	// ------------- Optional query parameter "role" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "role", ctx.QueryParams(), &params.Role)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter role: %s", err))
+	}
+
+	// ------------- Optional query parameter "createdFrom" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "createdFrom", ctx.QueryParams(), &params.CreatedFrom)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter createdFrom: %s", err))
+	}
+
+	// ------------- Optional query parameter "createdTo" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "createdTo", ctx.QueryParams(), &params.CreatedTo)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter createdTo: %s", err))
+	}
+
+	// ------------- Optional query parameter "sort" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "sort", ctx.QueryParams(), &params.Sort)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter sort: %s", err))
+	}
+
+	// ------------- Optional query parameter "includeDeleted" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "includeDeleted", ctx.QueryParams(), &params.IncludeDeleted)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter includeDeleted: %s", err))
+	}
 
 	// Invoke the callback with all the unmarshaled arguments
-	err = w.Handler.GetUsers(ctx)
+	err = w.Handler.GetUsers(ctx, params)
 	return err
 }
 
@@ -76,10 +447,68 @@ func (w *ServerInterfaceWrapper) GetUsers(ctx echo.Context) error {
 func (w *ServerInterfaceWrapper) CreateUser(ctx echo.Context) error {
 	var err error
 
-	ctx.Set(BearerAuthScopes, []string{})
+	ctx.Set(BearerAuthScopes, []string{"users:write"})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params CreateUserParams
+
+	headers := ctx.Request().Header
+	// ------------- Optional header parameter "Idempotency-Key" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("Idempotency-Key")]; found {
+		var IdempotencyKey IdempotencyKey
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for Idempotency-Key, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithLocation("simple", false, "Idempotency-Key", runtime.ParamLocationHeader, valueList[0], &IdempotencyKey)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter Idempotency-Key: %s", err))
+		}
+
+		params.IdempotencyKey = &IdempotencyKey
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.CreateUser(ctx, params)
+	return err
+}
+
+// DeleteUser converts echo context to params.
+func (w *ServerInterfaceWrapper) DeleteUser(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "userId" -------------
+	var userId UserId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "userId", runtime.ParamLocationPath, ctx.Param("userId"), &userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter userId: %s", err))
+	}
+
+	ctx.Set(BearerAuthScopes, []string{"users:write"})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params DeleteUserParams
+
+	headers := ctx.Request().Header
+	// ------------- Optional header parameter "If-Match" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("If-Match")]; found {
+		var IfMatch IfMatch
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for If-Match, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithLocation("simple", false, "If-Match", runtime.ParamLocationHeader, valueList[0], &IfMatch)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter If-Match: %s", err))
+		}
+
+		params.IfMatch = &IfMatch
+	}
 
 	// Invoke the callback with all the unmarshaled arguments
-	err = w.Handler.CreateUser(ctx)
+	err = w.Handler.DeleteUser(ctx, userId, params)
 	return err
 }
 
@@ -87,17 +516,322 @@ func (w *ServerInterfaceWrapper) CreateUser(ctx echo.Context) error {
 func (w *ServerInterfaceWrapper) GetUserById(ctx echo.Context) error {
 	var err error
 	// ------------- Path parameter "userId" -------------
-	var userId int
+	var userId UserId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "userId", runtime.ParamLocationPath, ctx.Param("userId"), &userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter userId: %s", err))
+	}
+
+	ctx.Set(BearerAuthScopes, []string{"users:read"})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetUserByIdParams
+	// ------------- Optional query parameter "includeDeleted" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "includeDeleted", ctx.QueryParams(), &params.IncludeDeleted)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter includeDeleted: %s", err))
+	}
+
+	headers := ctx.Request().Header
+	// ------------- Optional header parameter "If-None-Match" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("If-None-Match")]; found {
+		var IfNoneMatch IfNoneMatch
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for If-None-Match, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithLocation("simple", false, "If-None-Match", runtime.ParamLocationHeader, valueList[0], &IfNoneMatch)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter If-None-Match: %s", err))
+		}
+
+		params.IfNoneMatch = &IfNoneMatch
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.GetUserById(ctx, userId, params)
+	return err
+}
+
+// PatchUser converts echo context to params.
+func (w *ServerInterfaceWrapper) PatchUser(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "userId" -------------
+	var userId UserId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "userId", runtime.ParamLocationPath, ctx.Param("userId"), &userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter userId: %s", err))
+	}
+
+	ctx.Set(BearerAuthScopes, []string{"users:write"})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params PatchUserParams
+
+	headers := ctx.Request().Header
+	// ------------- Optional header parameter "If-Match" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("If-Match")]; found {
+		var IfMatch IfMatch
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for If-Match, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithLocation("simple", false, "If-Match", runtime.ParamLocationHeader, valueList[0], &IfMatch)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter If-Match: %s", err))
+		}
+
+		params.IfMatch = &IfMatch
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.PatchUser(ctx, userId, params)
+	return err
+}
+
+// ReplaceUser converts echo context to params.
+func (w *ServerInterfaceWrapper) ReplaceUser(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "userId" -------------
+	var userId UserId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "userId", runtime.ParamLocationPath, ctx.Param("userId"), &userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter userId: %s", err))
+	}
+
+	ctx.Set(BearerAuthScopes, []string{"users:write"})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params ReplaceUserParams
+
+	headers := ctx.Request().Header
+	// ------------- Optional header parameter "If-Match" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("If-Match")]; found {
+		var IfMatch IfMatch
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for If-Match, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithLocation("simple", false, "If-Match", runtime.ParamLocationHeader, valueList[0], &IfMatch)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter If-Match: %s", err))
+		}
+
+		params.IfMatch = &IfMatch
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.ReplaceUser(ctx, userId, params)
+	return err
+}
+
+// GetUserProfile converts echo context to params.
+func (w *ServerInterfaceWrapper) GetUserProfile(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "userId" -------------
+	var userId UserId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "userId", runtime.ParamLocationPath, ctx.Param("userId"), &userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter userId: %s", err))
+	}
+
+	ctx.Set(BearerAuthScopes, []string{"users:read"})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetUserProfileParams
+
+	headers := ctx.Request().Header
+	// ------------- Optional header parameter "If-None-Match" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("If-None-Match")]; found {
+		var IfNoneMatch IfNoneMatch
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for If-None-Match, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithLocation("simple", false, "If-None-Match", runtime.ParamLocationHeader, valueList[0], &IfNoneMatch)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter If-None-Match: %s", err))
+		}
+
+		params.IfNoneMatch = &IfNoneMatch
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.GetUserProfile(ctx, userId, params)
+	return err
+}
+
+// ReplaceUserProfile converts echo context to params.
+func (w *ServerInterfaceWrapper) ReplaceUserProfile(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "userId" -------------
+	var userId UserId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "userId", runtime.ParamLocationPath, ctx.Param("userId"), &userId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter userId: %s", err))
+	}
+
+	ctx.Set(BearerAuthScopes, []string{"users:profile:write"})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params ReplaceUserProfileParams
+
+	headers := ctx.Request().Header
+	// ------------- Optional header parameter "If-Match" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("If-Match")]; found {
+		var IfMatch IfMatch
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for If-Match, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithLocation("simple", false, "If-Match", runtime.ParamLocationHeader, valueList[0], &IfMatch)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter If-Match: %s", err))
+		}
+
+		params.IfMatch = &IfMatch
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.ReplaceUserProfile(ctx, userId, params)
+	return err
+}
+
+// RestoreUser converts echo context to params.
+func (w *ServerInterfaceWrapper) RestoreUser(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "userId" -------------
+	var userId UserId
 
 	err = runtime.BindStyledParameterWithLocation("simple", false, "userId", runtime.ParamLocationPath, ctx.Param("userId"), &userId)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter userId: %s", err))
 	}
 
-	ctx.Set(BearerAuthScopes, []string{})
+	ctx.Set(BearerAuthScopes, []string{"users:write"})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params RestoreUserParams
+
+	headers := ctx.Request().Header
+	// ------------- Optional header parameter "If-Match" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("If-Match")]; found {
+		var IfMatch IfMatch
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for If-Match, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithLocation("simple", false, "If-Match", runtime.ParamLocationHeader, valueList[0], &IfMatch)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter If-Match: %s", err))
+		}
+
+		params.IfMatch = &IfMatch
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.RestoreUser(ctx, userId, params)
+	return err
+}
+
+// BatchCreateUsers converts echo context to params.
+func (w *ServerInterfaceWrapper) BatchCreateUsers(ctx echo.Context) error {
+	var err error
+
+	ctx.Set(BearerAuthScopes, []string{"users:write"})
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.BatchCreateUsers(ctx)
+	return err
+}
+
+// BatchGetUsers converts echo context to params.
+func (w *ServerInterfaceWrapper) BatchGetUsers(ctx echo.Context) error {
+	var err error
+
+	ctx.Set(BearerAuthScopes, []string{"users:read"})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params BatchGetUsersParams
+	// ------------- Optional query parameter "includeDeleted" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "includeDeleted", ctx.QueryParams(), &params.IncludeDeleted)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter includeDeleted: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.BatchGetUsers(ctx, params)
+	return err
+}
+
+// ExportUsers converts echo context to params.
+func (w *ServerInterfaceWrapper) ExportUsers(ctx echo.Context) error {
+	var err error
+
+	ctx.Set(BearerAuthScopes, []string{"users:read"})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params ExportUsersParams
+	// ------------- Optional query parameter "fields" -------------
+
+	err = runtime.BindQueryParameter("form", false, false, "fields", ctx.QueryParams(), &params.Fields)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter fields: %s", err))
+	}
+
+	// ------------- Optional query parameter "includeDeleted" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "includeDeleted", ctx.QueryParams(), &params.IncludeDeleted)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter includeDeleted: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.ExportUsers(ctx, params)
+	return err
+}
+
+// WatchUsers converts echo context to params.
+func (w *ServerInterfaceWrapper) WatchUsers(ctx echo.Context) error {
+	var err error
+
+	ctx.Set(BearerAuthScopes, []string{"users:read"})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params WatchUsersParams
+
+	headers := ctx.Request().Header
+	// ------------- Optional header parameter "Last-Event-ID" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("Last-Event-ID")]; found {
+		var LastEventID string
+		n := len(valueList)
+		if n != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Expected one value for Last-Event-ID, got %d", n))
+		}
+
+		err = runtime.BindStyledParameterWithLocation("simple", false, "Last-Event-ID", runtime.ParamLocationHeader, valueList[0], &LastEventID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter Last-Event-ID: %s", err))
+		}
+
+		params.LastEventID = &LastEventID
+	}
 
 	// Invoke the callback with all the unmarshaled arguments
-	err = w.Handler.GetUserById(ctx, userId)
+	err = w.Handler.WatchUsers(ctx, params)
 	return err
 }
 
@@ -131,23 +865,78 @@ func RegisterHandlersWithBaseURL(router EchoRouter, si ServerInterface, baseURL
 
 	router.GET(baseURL+"/users", wrapper.GetUsers)
 	router.POST(baseURL+"/users", wrapper.CreateUser)
+	router.DELETE(baseURL+"/users/:userId", wrapper.DeleteUser)
 	router.GET(baseURL+"/users/:userId", wrapper.GetUserById)
+	router.PATCH(baseURL+"/users/:userId", wrapper.PatchUser)
+	router.PUT(baseURL+"/users/:userId", wrapper.ReplaceUser)
+	router.GET(baseURL+"/users/:userId/profile", wrapper.GetUserProfile)
+	router.PUT(baseURL+"/users/:userId/profile", wrapper.ReplaceUserProfile)
+	router.POST(baseURL+"/users/:userId:restore", wrapper.RestoreUser)
+	router.POST(baseURL+"/users:batchCreate", wrapper.BatchCreateUsers)
+	router.POST(baseURL+"/users:batchGet", wrapper.BatchGetUsers)
+	router.GET(baseURL+"/users:export", wrapper.ExportUsers)
+	router.GET(baseURL+"/users:watch", wrapper.WatchUsers)
 
 }
 
 // Base64 encoded, gzipped, json marshaled Swagger object
 var swaggerSpec = []string{
 
-	"H4sIAAAAAAAC/8xUT2/bPgz9KgZ/v6NQZ39Ovq3rNmSXHtqihyIHxWZitbakUVS2IPB3HyjZTbqk6A4d",
-	"0JNliXrUe3zkDmrXe2fRcoBqB6Fusddp+YXIkSw8OY/EBtN2jyHoNcqStx6hgsBk7BoGBaGL6xMHgwLC",
-	"H9EQNlDd5Sj1CLRQU7xb3mPNAnQT8ERq7LXpTiY2jWyvHPWaoYIYTQPqOMzq/vTDvQ7hp6OnKI+b6gVC",
-	"CVaNzzsAe45ZImMY+7T4n3AFFfxX7itRjmUokw7DI4wm0tuUPmAdyfD2SgKzOkvUhPQpcrv/+zpx+X57",
-	"DSpXV4Dy6Z5Yy+xhEGBjV07u186yrlmWWTWYb7QtrvTSNA4UROrGe6Eqy7XhNi7PateXoXXsHrSVZzcY",
-	"ajKejbNQwfXlxaWkNNwJ3q3pmuLW0YOLHIqYdFGwQQo5/N3Z7GwmKM6j1d5ABR/SlijMbeJcxknONaa3",
-	"il205Js3UME35JsRlzB4Z0OW6v1sNnFEm+5p7ztTp5vlfZD8Uy/8TYlC1u4pXXaNyyKsdOz41RLmvjyR",
-	"MFr85bFmbArcx3gXTijzmVAzJntlL2Pgc9dsX1WWZ1U5bB+miMNRfT7K5w3qOajRc+VOPvNmeMl859t5",
-	"kyxLukdObr37k9r8onCrgltMbVCwKwRRmjGNIW5hml2Qsx4pqA7Ijj1tLOM6FWHxj+3/Zt1/OCmT7Icz",
-	"8m4hwgSkzVSUpzNt17rAovpQyvRRsNFk9LLLGk6H2acjR+hcrTs5kuyL4XcAAAD//x5e5nJeBwAA",
+	"H4sIAAAAAAAC/+wba3PjtvGvYNDOpG0oyb47JxP1k+98l3FyD48fvQ/JfYDIlYgcCTAAaFu90X/vLB4k",
+	"KFHP2E7a5pMtAlgs9o3dxReayrKSAoTRdPyFVkyxEgwo++s8g7KSBkQ6/xHm+CUDnSpeGS4FHdMbwX+t",
+	"gXyGOZFTYnIgCn6tQZuEKDCKgyZ33OR2RLPSzZyB8VN1JYWGsHTKlTYBwJD8CHNNmMI1lSFTqQgjGZsn",
+	"hImMpEx8ZcgEgdQaMjcspMlBBQikBCbucl7A8GdBE8oR4RxYBoomVLAS6Dg+4ABPmFCd5lAyPGrJ7t+C",
+	"mJmcjp+dnCS05CL8Pk6omVcIQBvFxYwuFgk9n75jJs1XqfT6ms3CIWsNKokpRaaMF5rUogCtmylEG14U",
+	"JGf4iWtyC0pzuf4Y04HbO8a/D8P3UsBeWFpkuCZSFHPkaa0EZOQuB0G4sfgFsm9HETffDU+RFnUGZ1CA",
+	"gWwV1dNCS48M0XJqBpmbabHViZOGrORCB2x+rUHNW2R4d4MYmwymrC4MHU9ZoaHh80TKApiw6N1oUOc9",
+	"aJ2fxfQLW1fM5O3OtVubUGQ/V3g6o2qIMZhKVTKDc2ue0QaDhj6LhAbVsUr6kmWXTpbwVyqFAWH/ZVVV",
+	"8JQhdqNfNKL4JdrmrwqmdEz/MmoNwMiN6tFrpaRyW3WPyMUtK3gWhJcuEvpKimnB0yfYPGhM6neMjEta",
+	"KwXCEG2YsQaFEQVa1ioFxPG9NKdpCpVhkwIeH1EhRWvVLDc14YI4FNB2oeWqlMzqFDKP3xtZi+wpaOio",
+	"QoREo4p7LhJ6oSCVIuM46Q3jBTwlJndMk1JmfMohI5qLFCzhvD1BwjXmDZVPwH0FqYHMQX50POtmQwJu",
+	"DiJRKZmC1k8jT0gO3noq60WRautcH/VG6sEws8DWIOZtnbP31iChJ1m1jv/y/Oy4GEQ+cNc69t3dRLDE",
+	"F0pO+QNyIYa55siVG16y9r8DBRZh2O56Wpv8qp78AqlZ3dwPhM2N/AxCh18VKI2I3QkuZhFyd7kkJUPH",
+	"zzKLXF1laGC5oVvioYQ26lkpWYEy3HmrErVmBj3nSagu6ll/RNB6y5/crKQB9KnZW7qjLxJ6KZ1AgKhL",
+	"XOI5ZBTjwv5no4NoaYtD0Jsu1qxL2k3yE3NhkdBUATOQnZqOa0cqDgwvwUYCLPsginmIBFZQ8iBezreF",
+	"HJZffnbERanIz1TPtYHyZ7rLhj6cOu0TIzDEBtWd6DAOwmhy4DGhZLzolQue9cVFWwG6kKsHXtWajJ0t",
+	"QUKV3L7ECt4ioU5Peil4zcvGchQMw5mciRkcTDa/1Y7SEe34G0RkSSMtOyy1Axc9tVpSx4rQp7FI65do",
+	"8V7ZaasaiHjaf7iBUu/COg9pkeBN7tytOjk6sobL/2ztFlOKzVcO5jbdAd9L0PbSsHKp4tYvI6FbZgQN",
+	"tUyRyJc5XqbumMZLrR+lyRIBINjTHUKIdSqzysbdDqZX+aHagZ05skqwxRYGhF02suB7MKv48ayL2xZS",
+	"xEJyvJ+Q8Gw7fmvJWHKtEYG9UO2ikxygG1sJ70AmDX7rDrhOXQ93mOvdwHp7zrS+k6or8s3HZQIm9E5x",
+	"A61528u2L9Fpyeo1m66j1xsORRaHJhtsZ2sxY4cSxwOx9Y/d9rrA5i3XPaoi4N5csBlcY0zY47Dwc7Bd",
+	"OJdUbAYJ8aJBpGh9GY70SWwjodsEU+9pgy9CMqvk4iI61XHyfySQ/ZRpg5wuPz/Yf1jho35WkAyMTUJ2",
+	"LiZtkKBkPcvJCD/r0ReXwVqMWs++ROhbZpi6UcXqzrkxFTo8/KvJzeXbsKNbQ3jJuoFQrXifNE247MlF",
+	"V8RIcnJ0hJgrlhpnwFYWFzJlfWR5+eqCvPiWFEzMajYDYtgsIQX/DATE4OaqD1SVS9ED6fXw+JsXRNTl",
+	"BJQH8fXxi+OTk5OTo+Nnz/sgYbD3715g56fvTwkOExwnKHIe5usa6T56xzK1j3N/AEehIa0VN/MrnOi4",
+	"PgGmQKHmtL/eBDb+8PGaJitSCMpezzUpuHYVAZ3KCmwSfE68CcA7KE/zcEstSVowXnZusaSstSEzxYQZ",
+	"kisHgikgOQfFVJrzlBVjlxoeh5u7na27H8dWCxP/8R9hDtyCmruPDkF7EW6GWVF4bEpXZ7DUsyljS4SW",
+	"MSj1LqPAxVSGfAVz9ihkyW+ZIFdswjOJxl0Vfp0ej0YzbvJ6MkxlOdK5NPIzE3QlPXH94ewDbskNyjj9",
+	"yIuMfJTqs6zDcWlCQ6p+TI+HR8MjhCIrEKzidEyf20+JzVtb1o4a4z1zgZYMrMMkOP0ezI2HGxePfloW",
+	"5Hfsnpd16fUCaeZoyp378J6jL1tf8JKbQNlukv7ZkQ3cEHAbt/lfDeG5MDCzCaxko2+rrNpLLFAlhOm2",
+	"3MEF6frIfjyraHxDeWPFHmNpxdHiLpcaiHU4RBum2hQ316RSMOX3CeEzIREWSZleRzIL4sIuOByZZmcf",
+	"j/Rt5Id2S60Fh7Vh03A3YgYdBZsae3vimvjrcB8Ofs0bJUvaW0iJ79P7UCAgM4GpVLArHtfyAbCwcSIK",
+	"o5bKkMk8ITgOIkPG2/KbEwfIHJ++Gnw1JB/x+5QXBqx8TOZelKRyR8HkI2LRSrs1nROwu+BB574SiyAw",
+	"t4xYROXTpQPjqs5ZQ1Dr49nBUlw7CP/Eke2gLzEQE6ZPolpLM1oqFi4+LZXHnh0dPWhu2MbQfYlhmUm0",
+	"pC+OjtaBafAaRTW7RdKas23LlosfsTO2Jjd2wz50HitgGf20+IQBi9Q9Ftzd4W5cjnTJhm8jfrdBwBHf",
+	"nuulzOYPSveQzllD+eWK6mJFDI4fvRxiEzpt/ubJCwIJfSvdgXrC4zbajvNPW0ssL46+2y6XTQ0YFzx7",
+	"tosgxwW0R1cBG9lZHVgkdOki40hVgOkJvq/avHbbmzEkZ3G7gY81swxtr5KlLZbo0KXielS0kWhOa2F4",
+	"4cJbXFTVagZZ0ng5nGlAWDNdgeLSm96utrrND9NW36HSYyNfrB7eSnNI6ltJeLGdPU0lGxcc7yAJPaXn",
+	"JxSHZGNM+3JuWzX2JPKSP9rBg0VtOevc1xYq+Jva87V8FNJsL7JHZuYQfj+dG9uLIb5dBylb9bc+3dgk",
+	"mo4qJRhSMfLD1Yf35B2oGRCbZyJ/u3zzinz7/Ltv/j4kNkLTlrCVAg3CtFcZnIsaXsDUoNbLOs0hG67o",
+	"soX6AKq8i8ct8RwDi9vXB1TE3W6LxXY/u4e87m9S9vZG/w02qKp7SkeXUBUsBZdhwNnoKl1E3snUrUqV",
+	"X/lEcvXbIrk/hemx45tRVO3e5Owu2nzunhLzEN4rqrP/6cS2OLGN1gIJcpfLordLKQn2wzomWRvrpdIC",
+	"Mc2G2KAoa2H8JJ9mxrX23p64yb4sIEUDlXCjoZj2BauRKTpcvh7fInX6vR7IJEUSfUBK4H8n2O5k19fY",
+	"qLG/Ii2/QNhPL6TuVQwLWRO22iruawvYxY6mZQIg/KWMzMH0OVYL66HvXn/6uAN93Hiy1DHUKwFuXJOS",
+	"iZDYxeyySGFIXjfFHYKvLLC33aWf8fbu0yToWYzG5sjwcAN7OdCsAktzIgXg2rhYgLOkylyVI3rr0Wch",
+	"o56YUEZ5LCsXbbWHpXuM7UM7TH9beKBuyxtPxknr1f9gOda1whl6k9bYJpSZPslM+sSIK3J+1hTMmodS",
+	"17a5TLcVNWfVMondZHDPtXGe21s+2+wXvZ9iTdo/ZUUBys5tpJnp0OfRoGQfclm81srz+prgIcn8R9QG",
+	"ZM/vpQpRW9iG1nrtXmlYi2Q8pz1H/tjVhlYR4L6SykT3j6Ukq1HAyrjQHr/gcvLtimhoZ9NcahBBZP2T",
+	"GpdpT8j7M5uyCY/p4N6MUn1LfPEUlI1yL3wfDvr93PcKCNycOEShN+362o7tVOn2mSEjPUCvOVw7rUni",
+	"ngE8SGBIQuG+KmQGzeOzvqKbC847efuduzksZn0dhNrMbb8A0pk+etHtfiCygyouCQ087S7teSLXZQk6",
+	"aetJKlCk4MKH5d/sFExFT8d+D/W5C0nLjdpj8nA3izwB0+QK1C2owRUIg9GOMLqrXS4CAhxBPUEhy6KK",
+	"hAOZhGAo8S9AMnQijUNxtQ5l3/s2l8JlGENyCakUAlJja9jh6V7bF207CB0mClLgt5DZYKv0YKfQoMbN",
+	"P/0RFZTy1j+DmkmZtc9+nWJLBObUGoGIIXklyxL3QDFw2m+Tt0yjGVFmAsxo/8ZBSJMjsp6wfXbhY0jh",
+	"bjULGw+aoLlwh10967o3tW+ZNgPL1MH52cZK3nb9tIplcRpoK1J7aphbFEQvUOwP7qI2zv6EVNNWfRw7",
+	"u+1YX3KpDTJiMWIVx64qpjgaCUvgMNjpVnK9hziEFPy0+M8AV7ksLH0/AAA=",
 }
 
 // GetSwagger returns the content of the embedded swagger specification file
@@ -0,0 +1,150 @@
+package ports
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	commonerrors "github.com/shotokan/firebase-training/internal/common/errors"
+	"github.com/shotokan/firebase-training/internal/users/models"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	mimeEventStream = "text/event-stream"
+	// watchHeartbeatInterval keeps idle streams from being closed by proxies,
+	// and detects clients gone without closing the connection.
+	watchHeartbeatInterval = 15 * time.Second
+	// watchRetry is the reconnection delay advised to clients.
+	watchRetry = 3 * time.Second
+)
+
+var (
+	errInvalidLastEventID = commonerrors.NewIncorrectInputError("Last-Event-ID is not an event of this feed", "invalid-last-event-id")
+)
+
+// WatchUsers streams the changes of users as Server-Sent Events until the
+// client disconnects.
+func (h HttpServer) WatchUsers(ctx echo.Context, params WatchUsersParams) error {
+	if err := h.authorize(ctx.Request().Context(), UserActionWatch, nil); err != nil {
+		return commonerrors.RespondWithSlugError(err)
+	}
+
+	var after *models.UserChangePosition
+	if params.LastEventID != nil && *params.LastEventID != "" {
+		position, err := parseEventID(*params.LastEventID)
+		if err != nil {
+			return commonerrors.RespondWithSlugError(err)
+		}
+		after = &position
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx.Request().Context())
+
+	// The repository calls back from its own goroutine, the stream is only
+	// written here.
+	changes := make(chan models.UserChange)
+	watchErr := make(chan error, 1)
+	watchDone := make(chan struct{})
+	// The watch is stopped before returning, so it never outlives the request.
+	defer func() {
+		cancel()
+		<-watchDone
+	}()
+	go func() {
+		defer close(watchDone)
+		watchErr <- h.repo.WatchUsers(watchCtx, after, func(change models.UserChange) error {
+			select {
+			case changes <- change:
+				return nil
+			case <-watchCtx.Done():
+				return watchCtx.Err()
+			}
+		})
+	}()
+
+	header := ctx.Response().Header()
+	header.Set(echo.HeaderContentType, mimeEventStream)
+	header.Set(echo.HeaderCacheControl, "no-cache")
+	// Keeps nginx from buffering the stream.
+	header.Set("X-Accel-Buffering", "no")
+	ctx.Response().WriteHeader(http.StatusOK)
+
+	stream := bufio.NewWriter(ctx.Response())
+	fmt.Fprintf(stream, "retry: %d\n\n", watchRetry.Milliseconds())
+	if err := flushEvents(ctx, stream); err != nil {
+		return nil
+	}
+
+	heartbeat := time.NewTicker(watchHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case change := <-changes:
+			if err := writeChangeEvent(stream, change); err != nil {
+				logrus.WithError(err).Error("Unable to encode user change")
+				return nil
+			}
+		case <-heartbeat.C:
+			stream.WriteString(": heartbeat\n\n")
+		case err := <-watchErr:
+			// The status is sent already, the client reconnects and resumes.
+			if err != nil {
+				logrus.WithError(err).Warn("User watch stopped")
+			}
+			return nil
+		case <-watchCtx.Done():
+			return nil
+		}
+
+		if err := flushEvents(ctx, stream); err != nil {
+			return nil
+		}
+	}
+}
+
+func writeChangeEvent(stream *bufio.Writer, change models.UserChange) error {
+	data, err := json.Marshal(userModelToResponse(change.User))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stream, "id: %s\nevent: %s\ndata: %s\n\n", eventID(change.Position), change.Type, data)
+
+	return nil
+}
+
+// flushEvents sends the buffered events, it fails once the client is gone.
+func flushEvents(ctx echo.Context, stream *bufio.Writer) error {
+	if err := stream.Flush(); err != nil {
+		return err
+	}
+
+	return http.NewResponseController(ctx.Response().Writer).Flush()
+}
+
+// eventID encodes a change position, user IDs contain no dots.
+func eventID(position models.UserChangePosition) string {
+	return strconv.FormatInt(position.Time.UnixNano(), 36) + "." + position.UserID
+}
+
+func parseEventID(id string) (models.UserChangePosition, error) {
+	nanos, userID, ok := strings.Cut(id, ".")
+	if !ok || userID == "" {
+		return models.UserChangePosition{}, errInvalidLastEventID
+	}
+
+	unixNano, err := strconv.ParseInt(nanos, 36, 64)
+	if err != nil {
+		return models.UserChangePosition{}, errInvalidLastEventID
+	}
+
+	return models.UserChangePosition{Time: time.Unix(0, unixNano).UTC(), UserID: userID}, nil
+}